@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
+
+	api_model "github.com/IlfGauhnith/GophicProcessor/cmd/api/model"
+	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	phash "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/phash"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultMaxDistance is the Hamming distance under which
+// two 64 bit hashes are considered the same picture.
+const defaultMaxDistance = 10
+
+// PostFindDuplicatesHandler hashes the given image and returns
+// the near-duplicates found among the user's previous uploads.
+func PostFindDuplicatesHandler(c *gin.Context) {
+	logger.Log.Info("PostFindDuplicatesHandler")
+
+	var requestStruct api_model.DuplicatesRequest
+	if err := c.ShouldBindJSON(&requestStruct); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	maxDistance := defaultMaxDistance
+	if requestStruct.MaxDistance != nil {
+		maxDistance = *requestStruct.MaxDistance
+	}
+
+	hashKind := requestStruct.Hash
+	if hashKind == "" {
+		hashKind = "phash"
+	}
+	if _, err := hashValue(model.ImageHashes{}, hashKind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	img, err := util.DecodeBase64Image(requestStruct.Image)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
+	if err != nil {
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	hashes := model.ImageHashes{
+		AHash: phash.AHash(img),
+		DHash: phash.DHash(img),
+		PHash: phash.PHash(img),
+	}
+
+	target, _ := hashValue(hashes, hashKind)
+	records, err := data_handler.FindSimilarImageHashes(c.Request.Context(), authenticatedUser.ID, hashKind, target, maxDistance)
+	if err != nil {
+		logger.Log.Errorf("Failed to get image hashes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving image hashes."})
+		return
+	}
+
+	duplicates := findDuplicates(hashes, records, hashKind, maxDistance, nil)
+	c.JSON(http.StatusOK, gin.H{"hashes": hashes, "duplicates": duplicates})
+}
+
+// GetResizeJobDuplicatesHandler returns, for every image of a job, the near-duplicates
+// found among the user's uploads, including the other images of the same job.
+func GetResizeJobDuplicatesHandler(c *gin.Context) {
+	logger.Log.Info("GetResizeJobDuplicatesHandler")
+
+	// Extract job ID from the URL
+	jobId := c.Param("jobId")
+	if jobId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Job ID is required"})
+		return
+	}
+
+	maxDistance := defaultMaxDistance
+	if value := c.Query("maxDistance"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid maxDistance"})
+			return
+		}
+		maxDistance = parsed
+	}
+
+	hashKind := c.DefaultQuery("hash", "phash")
+	if _, err := hashValue(model.ImageHashes{}, hashKind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Extract user
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
+	if err != nil {
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	// Records are owned by the authenticated user, so finding the job
+	// among them is enough to know the user is allowed to see it.
+	records, err := data_handler.GetImageHashesByJob(c.Request.Context(), jobId, authenticatedUser.ID)
+	if err != nil {
+		logger.Log.Errorf("Failed to get image hashes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving image hashes."})
+		return
+	}
+
+	type imageDuplicates struct {
+		ImageIndex int                    `json:"image_index"`
+		Duplicates []model.DuplicateMatch `json:"duplicates"`
+	}
+
+	response := []imageDuplicates{}
+	for _, record := range records {
+		target, _ := hashValue(record.Hashes, hashKind)
+		candidates, err := data_handler.FindSimilarImageHashes(c.Request.Context(), authenticatedUser.ID, hashKind, target, maxDistance)
+		if err != nil {
+			logger.Log.Errorf("Failed to get image hashes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving image hashes."})
+			return
+		}
+
+		self := record
+		duplicates := findDuplicates(record.Hashes, candidates, hashKind, maxDistance, func(candidate model.ImageHashRecord) bool {
+			return candidate.JobID == self.JobID && candidate.ImageIndex == self.ImageIndex
+		})
+		response = append(response, imageDuplicates{ImageIndex: record.ImageIndex, Duplicates: duplicates})
+	}
+
+	if len(response) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// findDuplicates returns the records within maxDistance of hashes, closest first.
+// Records for which skip returns true are ignored.
+func findDuplicates(hashes model.ImageHashes, records []model.ImageHashRecord, hashKind string, maxDistance int, skip func(model.ImageHashRecord) bool) []model.DuplicateMatch {
+	target, _ := hashValue(hashes, hashKind)
+
+	duplicates := []model.DuplicateMatch{}
+	for _, record := range records {
+		if skip != nil && skip(record) {
+			continue
+		}
+
+		candidate, _ := hashValue(record.Hashes, hashKind)
+		if distance := phash.Distance(target, candidate); distance <= maxDistance {
+			duplicates = append(duplicates, model.DuplicateMatch{
+				JobID:      record.JobID,
+				ImageIndex: record.ImageIndex,
+				ImageURL:   record.ImageURL,
+				Distance:   distance,
+			})
+		}
+	}
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Distance < duplicates[j].Distance
+	})
+	return duplicates
+}
+
+// hashValue picks one of the hashes by name.
+func hashValue(hashes model.ImageHashes, hashKind string) (uint64, error) {
+	switch hashKind {
+	case "ahash":
+		return hashes.AHash, nil
+	case "dhash":
+		return hashes.DHash, nil
+	case "phash":
+		return hashes.PHash, nil
+	default:
+		return 0, fmt.Errorf("unknown hash: %s", hashKind)
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	middleware "github.com/IlfGauhnith/GophicProcessor/cmd/api/middleware"
+	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	events "github.com/IlfGauhnith/GophicProcessor/pkg/events"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
+	"github.com/gin-gonic/gin"
+)
+
+// keepAliveInterval is how often a comment is sent on idle streams,
+// so that proxies don't close them.
+const keepAliveInterval = 15 * time.Second
+
+// finished reports whether a job reached a status it won't leave.
+func finished(status string) bool {
+	return status == "Completed" || status == "Failed" || status == "Cancelled"
+}
+
+// GetResizeJobEventsHandler streams the status and progress changes of a job of the
+// authenticated user as Server-Sent Events, starting with its current state.
+// The stream ends once the job is finished.
+func GetResizeJobEventsHandler(c *gin.Context) {
+	logger.Log.Info("GetResizeJobEvents")
+
+	jobId := c.Param("jobId")
+	if jobId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Job ID is required"})
+		return
+	}
+
+	claims := c.MustGet(middleware.StreamClaimsKey).(*util.StreamClaims)
+
+	// Subscribing first, no change can be missed between the read and the stream.
+	jobEvents, unsubscribe := events.Subscribe(claims.UserID, jobId)
+	defer unsubscribe()
+
+	job, err := data_handler.GetResizeJob(c.Request.Context(), jobId)
+	if err != nil || job.OwnerID != claims.UserID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	current := model.JobEvent{
+		JobID:     job.JobID,
+		OwnerID:   job.OwnerID,
+		Status:    job.Status,
+		Progress:  job.Progress,
+		ErrorCode: job.ErrorCode,
+	}
+	streamEvents(c, &current, jobEvents, true)
+}
+
+// GetUserJobEventsHandler streams the status and progress changes of all the jobs
+// of the authenticated user as Server-Sent Events, until the client disconnects.
+func GetUserJobEventsHandler(c *gin.Context) {
+	logger.Log.Info("GetUserJobEvents")
+
+	claims := c.MustGet(middleware.StreamClaimsKey).(*util.StreamClaims)
+
+	jobEvents, unsubscribe := events.Subscribe(claims.UserID, "")
+	defer unsubscribe()
+
+	streamEvents(c, nil, jobEvents, false)
+}
+
+// PostResizeJobEventsTokenHandler issues a stream token opening the event stream
+// of a job of the authenticated user.
+func PostResizeJobEventsTokenHandler(c *gin.Context) {
+	logger.Log.Info("PostResizeJobEventsToken")
+
+	jobId := c.Param("jobId")
+	if jobId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Job ID is required"})
+		return
+	}
+
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
+	if err != nil {
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	job, err := data_handler.GetResizeJob(c.Request.Context(), jobId)
+	if err != nil || job.OwnerID != authenticatedUser.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	issueStreamToken(c, util.StreamClaims{UserID: authenticatedUser.ID, JobID: jobId})
+}
+
+// PostUserJobEventsTokenHandler issues a stream token opening the event stream
+// of all the jobs of the authenticated user.
+func PostUserJobEventsTokenHandler(c *gin.Context) {
+	logger.Log.Info("PostUserJobEventsToken")
+
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
+	if err != nil {
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	issueStreamToken(c, util.StreamClaims{UserID: authenticatedUser.ID})
+}
+
+func issueStreamToken(c *gin.Context, claims util.StreamClaims) {
+	token, err := util.GenerateStreamToken(claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue stream token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":     token,
+		"expiresIn": int(util.StreamTokenTTL.Seconds()),
+	})
+}
+
+// streamEvents sends first, when it isn't nil, then every event as a "job" event.
+// With untilFinished, the stream ends after the first event of a finished job.
+func streamEvents(c *gin.Context, first *model.JobEvent, jobEvents <-chan model.JobEvent, untilFinished bool) {
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Keeps nginx from buffering the stream.
+	c.Header("X-Accel-Buffering", "no")
+
+	if first != nil {
+		c.SSEvent("job", first)
+		c.Writer.Flush()
+		if untilFinished && finished(first.Status) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-jobEvents:
+			if !ok {
+				// The stream fell behind, the client reconnects and starts over from the current state.
+				return false
+			}
+			c.SSEvent("job", event)
+			return !untilFinished || !finished(event.Status)
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			return true
+		}
+	})
+}
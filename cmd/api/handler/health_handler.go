@@ -5,10 +5,18 @@ import (
 
 	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
 	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	"github.com/IlfGauhnith/GophicProcessor/pkg/mq"
 	"github.com/gin-gonic/gin"
 )
 
 func HealthHandler(c *gin.Context) {
 	logger.Log.Info("HealthHandler")
-	c.JSON(http.StatusOK, gin.H{"status": "API is running"})
+
+	// Jobs can't be submitted while the broker is unreachable.
+	if err := mq.Health(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "API is degraded", "broker": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "API is running", "broker": "connected"})
 }
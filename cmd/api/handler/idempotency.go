@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+
+	api_model "github.com/IlfGauhnith/GophicProcessor/cmd/api/model"
+)
+
+const (
+	// idempotencyKeyHeader lets clients retry a submission without creating the job twice.
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks the responses of repeated submissions.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength  = 255
+	defaultIdempotencyKeyTTL = 24 * time.Hour
+	// idempotencyKeyPendingTimeout frees the key of a submission that died before
+	// creating its job.
+	idempotencyKeyPendingTimeout = time.Minute
+)
+
+// idempotencyKeyTTL is how long a key stays bound to its job,
+// from IDEMPOTENCY_KEY_TTL as a Go duration.
+func idempotencyKeyTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_KEY_TTL"))
+	if err != nil || ttl <= 0 {
+		return defaultIdempotencyKeyTTL
+	}
+	return ttl
+}
+
+// requestFingerprint identifies the content of a submission. It is computed
+// from the decoded request, the formatting of the JSON body doesn't matter.
+func requestFingerprint(request api_model.ResizeRequest) (string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -4,13 +4,23 @@ import (
 	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
 	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
 
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	api_model "github.com/IlfGauhnith/GophicProcessor/cmd/api/model"
 	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	crop "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/crop"
+	palette "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/palette"
+	quantize "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/quantize"
+	redact "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/redact"
+	resize "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/resize"
+	trim "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/trim"
 	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
 	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
 	"github.com/IlfGauhnith/GophicProcessor/pkg/mq"
+	webhook "github.com/IlfGauhnith/GophicProcessor/pkg/webhook"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -25,6 +35,107 @@ func PostResizeImagesHandler(c *gin.Context) {
 		return
 	}
 
+	mode := requestStruct.Mode
+	switch mode {
+	case "":
+		mode = resize.ModeResize
+	case resize.ModeResize:
+	case resize.ModeResponsive:
+		if _, err := resize.ResponsiveWidths(requestStruct.Preset, requestStruct.Widths); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	case resize.ModeCompare:
+		if _, err := resize.CompareAlgorithms(requestStruct.Algorithms); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job mode"})
+		return
+	}
+
+	// Compare jobs name their algorithms in Algorithms instead.
+	if mode != resize.ModeCompare {
+		if _, err := resize.GetResizeStrategy(requestStruct.Algorithm); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !resize.ValidFit(requestStruct.Fit) || !crop.ValidGravity(requestStruct.Gravity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fit or gravity"})
+		return
+	}
+
+	if (requestStruct.Fit == resize.FitCover || requestStruct.Fit == resize.FitCrop) &&
+		(requestStruct.TargetWidth <= 0 || requestStruct.TargetHeight <= 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cover and crop fits require a target width and height"})
+		return
+	}
+
+	if (requestStruct.ProtectMask != "" || requestStruct.RemoveMask != "") && requestStruct.Algorithm != "seamcarve" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Masks are only supported by the seamcarve algorithm"})
+		return
+	}
+
+	if err := resize.ValidateMasks(requestStruct.ProtectMask, requestStruct.RemoveMask); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if requestStruct.Trim != nil {
+		if err := trim.Validate(requestStruct.Trim.Tolerance, requestStruct.Trim.Padding); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if requestStruct.Quantize != nil {
+		if err := quantize.Validate(*requestStruct.Quantize); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if _, err := resize.OutputFormat(requestStruct.OutputFormat, requestStruct.Quantize != nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := redact.Validate(requestStruct.Redactions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if requestStruct.PaletteSize < 0 || requestStruct.PaletteSize > palette.MaxColors {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid palette size"})
+		return
+	}
+
+	if !mq.ValidPriority(requestStruct.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority"})
+		return
+	}
+
+	if requestStruct.CallbackURL != "" {
+		if err := webhook.ValidateURL(requestStruct.CallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if requestStruct.RunAt != nil && !requestStruct.RunAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "runAt must be in the future"})
+		return
+	}
+
+	idempotencyKey := c.GetHeader(idempotencyKeyHeader)
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		return
+	}
+
 	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
 	if err != nil {
 		logger.Log.Errorf("Error parsing user from JWT: %v", err)
@@ -32,6 +143,19 @@ func PostResizeImagesHandler(c *gin.Context) {
 		return
 	}
 
+	// Webhooks are signed with the secret of their owner, it must exist beforehand
+	if requestStruct.CallbackURL != "" {
+		hasSecret, err := data_handler.HasWebhookSecret(c.Request.Context(), authenticatedUser.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check webhook secret"})
+			return
+		}
+		if !hasSecret {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A webhook secret is required for callbackUrl, create one with POST /webhooks/secret"})
+			return
+		}
+	}
+
 	// Casting api_model.ResizeRequest to model.ResizeJob
 	// model.ResizeJob struct has a field called JobID
 	// which is a unique identifier for the job
@@ -41,18 +165,127 @@ func PostResizeImagesHandler(c *gin.Context) {
 		Algorithm:    requestStruct.Algorithm,
 		TargetWidth:  requestStruct.TargetWidth,
 		TargetHeight: requestStruct.TargetHeight,
+		Mode:         mode,
+		Widths:       requestStruct.Widths,
+		Preset:       requestStruct.Preset,
+		Algorithms:   requestStruct.Algorithms,
+		PaletteSize:  requestStruct.PaletteSize,
+		Fit:          requestStruct.Fit,
+		Gravity:      requestStruct.Gravity,
+		ProtectMask:  requestStruct.ProtectMask,
+		RemoveMask:   requestStruct.RemoveMask,
+		Trim:         requestStruct.Trim,
+		Redactions:   requestStruct.Redactions,
+		OutputFormat: requestStruct.OutputFormat,
+		Quantize:     requestStruct.Quantize,
+		CallbackURL:  requestStruct.CallbackURL,
 		JobID:        jobID,
 		Status:       "In Progress",
 		OwnerID:      authenticatedUser.ID,
 	}
 
+	// A key already bound to a job replays the response of its first submission.
+	if idempotencyKey != "" {
+		fingerprint, err := requestFingerprint(requestStruct)
+		if err != nil {
+			logger.Log.Errorf("Error fingerprinting request: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save job"})
+			return
+		}
+
+		binding, reserved, err := data_handler.ReserveIdempotencyKey(c.Request.Context(), authenticatedUser.ID, model.IdempotencyKey{
+			Key:         idempotencyKey,
+			Fingerprint: fingerprint,
+			JobID:       jobID,
+		}, idempotencyKeyTTL(), idempotencyKeyPendingTimeout)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save job"})
+			return
+		}
+		if !reserved {
+			if binding.Fingerprint != fingerprint {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+				return
+			}
+			// Its job may not exist yet, or never if the first submission fails.
+			if binding.Pending {
+				c.Header("Retry-After", "1")
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress, please retry later"})
+				return
+			}
+
+			logger.Log.Infof("Replaying job %s for Idempotency-Key of user %d", binding.JobID, authenticatedUser.ID)
+			c.Header(idempotentReplayedHeader, "true")
+			if requestStruct.RunAt != nil {
+				c.JSON(http.StatusAccepted, gin.H{"job_id": binding.JobID, "runAt": requestStruct.RunAt})
+				return
+			}
+			c.JSON(http.StatusAccepted, gin.H{"job_id": binding.JobID})
+			return
+		}
+	}
+
+	// A submission that doesn't create its job frees its key for the retries,
+	// one that does hands its job to them.
+	releaseIdempotencyKey := func() {
+		if idempotencyKey != "" {
+			data_handler.ReleaseIdempotencyKey(context.WithoutCancel(c.Request.Context()), authenticatedUser.ID, idempotencyKey)
+		}
+	}
+	completeIdempotencyKey := func() {
+		if idempotencyKey != "" {
+			data_handler.CompleteIdempotencyKey(context.WithoutCancel(c.Request.Context()), authenticatedUser.ID, idempotencyKey)
+		}
+	}
+
 	logger.Log.Infof("jobID created: %s", jobID)
 
+	// Jobs of users whose tier can't be read are queued as free ones.
+	tier, err := data_handler.GetUserTier(c.Request.Context(), authenticatedUser.ID)
+	if err != nil {
+		logger.Log.Warnf("Failed to get the tier of user %d: %v", authenticatedUser.ID, err)
+	}
+	resizeJob.Priority = mq.JobPriority(resizeJob, requestStruct.Priority, tier)
+
+	// Scheduled jobs are published by the scheduler once they are due.
+	if requestStruct.RunAt != nil {
+		if err := data_handler.ScheduleResizeJob(c.Request.Context(), resizeJob, *requestStruct.RunAt); err != nil {
+			releaseIdempotencyKey()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule job"})
+			return
+		}
+		completeIdempotencyKey()
+		c.JSON(http.StatusAccepted, gin.H{"job_id": jobID, "runAt": requestStruct.RunAt})
+		return
+	}
+
+	// The job is recorded before it is queued so that it can be cancelled
+	// while it waits. The base64 inputs only travel through the queue.
+	record := resizeJob
+	record.Images = []string{}
+	if err := data_handler.SaveResizeJob(c.Request.Context(), record); err != nil {
+		releaseIdempotencyKey()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save job"})
+		return
+	}
+
 	if err := mq.PublishResizeJob(resizeJob); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish job"})
+		// The broker may have queued the job anyway: it keeps its status and its key,
+		// a retry gets the same job instead of submitting it twice.
+		if errors.Is(err, mq.ErrUnconfirmed) {
+			completeIdempotencyKey()
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Job queue didn't confirm the job, check its status before submitting it again", "job_id": jobID})
+			return
+		}
+
+		data_handler.UpdateResizeJobStatus(c.Request.Context(), jobID, "Failed")
+		releaseIdempotencyKey()
+		// The broker didn't take the job, it will never run: the client has to retry.
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Job queue is unavailable, please retry later"})
 		return
 	}
 	logger.Log.Infof("jobID successfully published: %s", jobID)
+	completeIdempotencyKey()
 
 	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID})
 }
@@ -67,10 +300,20 @@ func GetResizeJobStatusHandler(c *gin.Context) {
 		return
 	}
 
-	// Get the resize job from the database
-	job, err := data_handler.GetResizeJob(jobId)
+	// Extract user
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
 	if err != nil {
-		logger.Log.Errorf("Failed to get resize job status: %v", err)
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	// Get the resize job from the database, the jobs of other users don't exist for this one
+	job, err := data_handler.GetResizeJob(c.Request.Context(), jobId)
+	if err != nil || job.OwnerID != authenticatedUser.ID {
+		if err != nil {
+			logger.Log.Errorf("Failed to get resize job status: %v", err)
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
 		return
 	}
@@ -80,6 +323,13 @@ func GetResizeJobStatusHandler(c *gin.Context) {
 		"job_uuid": job.JobID,
 		"status":   job.Status,
 	}
+	if job.ErrorCode != "" {
+		response["errorCode"] = job.ErrorCode
+		response["error"] = job.Error
+	}
+	if job.Progress != nil {
+		response["progress"] = job.Progress
+	}
 
 	logger.Log.Infof("Job status retrieved successfully for job ID: %s", job.JobID)
 	c.JSON(http.StatusOK, response)
@@ -104,7 +354,7 @@ func GetResizeJobByIDHandler(c *gin.Context) {
 	}
 
 	// Get the resize job from the database
-	job, err := data_handler.GetResizeJob(jobId)
+	job, err := data_handler.GetResizeJob(c.Request.Context(), jobId)
 	if err != nil {
 		logger.Log.Errorf("Failed to get resize job status: %v", err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
@@ -132,7 +382,7 @@ func GetResizeJobHandler(c *gin.Context) {
 	}
 
 	// Get the resize job from the database
-	jobs, err := data_handler.GetResizeJobsByOwner(authenticatedUser.ID)
+	jobs, err := data_handler.GetResizeJobsByOwner(c.Request.Context(), authenticatedUser.ID)
 	if err != nil {
 		logger.Log.Errorf("Failed to get resize job status: %v", err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
@@ -141,3 +391,49 @@ func GetResizeJobHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, jobs)
 }
+
+// DeleteResizeJobHandler cancels a job of the authenticated user. A scheduled or queued job is
+// skipped by the workers, a job in progress stops and keeps the outputs already produced.
+func DeleteResizeJobHandler(c *gin.Context) {
+	logger.Log.Info("DeleteResizeJob")
+
+	jobId := c.Param("jobId")
+	if jobId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Job ID is required"})
+		return
+	}
+
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
+	if err != nil {
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	job, err := data_handler.GetResizeJob(c.Request.Context(), jobId)
+	if err != nil || job.OwnerID != authenticatedUser.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	cancelled, waiting, err := data_handler.CancelResizeJob(c.Request.Context(), jobId, authenticatedUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel job"})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only scheduled jobs and jobs in progress can be cancelled"})
+		return
+	}
+
+	// Jobs cancelled before they were queued never reach a worker, which notifies the others.
+	if waiting {
+		job.Status = "Cancelled"
+		if err := webhook.Enqueue(c.Request.Context(), *job); err != nil {
+			logger.Log.Errorf("Failed to enqueue webhook of job %s: %v", jobId, err)
+		}
+	}
+
+	logger.Log.Infof("Job %s cancelled by user %d", jobId, authenticatedUser.ID)
+	c.JSON(http.StatusOK, gin.H{"job_id": jobId, "status": "Cancelled"})
+}
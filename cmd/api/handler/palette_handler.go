@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
+
+	api_model "github.com/IlfGauhnith/GophicProcessor/cmd/api/model"
+	palette "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/palette"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// PostPaletteHandler returns the dominant colors of the given image.
+// The image is analyzed synchronously, nothing is stored.
+func PostPaletteHandler(c *gin.Context) {
+	logger.Log.Info("PostPaletteHandler")
+
+	var requestStruct api_model.PaletteRequest
+	if err := c.ShouldBindJSON(&requestStruct); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	colors := requestStruct.Colors
+	if colors == 0 {
+		colors = palette.DefaultColors
+	}
+
+	img, err := util.DecodeBase64Image(requestStruct.Image)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	extracted, err := palette.Extract(img, colors)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"palette": extracted})
+}
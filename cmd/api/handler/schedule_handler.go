@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	api_model "github.com/IlfGauhnith/GophicProcessor/cmd/api/model"
+	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
+	"github.com/gin-gonic/gin"
+)
+
+// GetScheduledJobsHandler lists the jobs of the authenticated user waiting for their time.
+func GetScheduledJobsHandler(c *gin.Context) {
+	logger.Log.Info("GetScheduledJobs")
+
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
+	if err != nil {
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	jobs, err := data_handler.GetScheduledJobsByOwner(c.Request.Context(), authenticatedUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving scheduled jobs."})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// PutRescheduleJobHandler moves a scheduled job of the authenticated user to a new time.
+func PutRescheduleJobHandler(c *gin.Context) {
+	logger.Log.Info("PutRescheduleJob")
+
+	jobId := c.Param("jobId")
+	if jobId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Job ID is required"})
+		return
+	}
+
+	var requestStruct api_model.RescheduleRequest
+	if err := c.ShouldBindJSON(&requestStruct); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if !requestStruct.RunAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "runAt must be in the future"})
+		return
+	}
+
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
+	if err != nil {
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	rescheduled, err := data_handler.RescheduleResizeJob(c.Request.Context(), jobId, authenticatedUser.ID, requestStruct.RunAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reschedule job"})
+		return
+	}
+	if !rescheduled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job_id": jobId, "runAt": requestStruct.RunAt})
+}
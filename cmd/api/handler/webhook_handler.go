@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+
+	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
+	webhook "github.com/IlfGauhnith/GophicProcessor/pkg/webhook"
+	"github.com/gin-gonic/gin"
+)
+
+// PostWebhookSecretHandler generates a new webhook secret for the authenticated user,
+// replacing the previous one. The secret is only returned here, the webhooks of the
+// user are signed with it from then on.
+func PostWebhookSecretHandler(c *gin.Context) {
+	logger.Log.Info("PostWebhookSecret")
+
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
+	if err != nil {
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		logger.Log.Errorf("Failed to generate webhook secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+		return
+	}
+
+	if err := data_handler.SetWebhookSecret(c.Request.Context(), authenticatedUser.ID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save webhook secret"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"secret": secret})
+}
+
+// PostRedeliverWebhookHandler sends the webhook of a finished job of the authenticated
+// user again, with a fresh set of retries. Its attempts keep counting up.
+func PostRedeliverWebhookHandler(c *gin.Context) {
+	logger.Log.Info("PostRedeliverWebhook")
+
+	jobId := c.Param("jobId")
+	if jobId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Job ID is required"})
+		return
+	}
+
+	authenticatedUser, err := util.GetUserFromJWT(c.Request.Header["Authorization"][0])
+	if err != nil {
+		logger.Log.Errorf("Error parsing user from JWT: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing user from JWT."})
+		return
+	}
+
+	redelivered, err := data_handler.RedeliverWebhook(c.Request.Context(), jobId, authenticatedUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver webhook"})
+		return
+	}
+	if !redelivered {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No webhook delivery found for this job"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobId})
+}
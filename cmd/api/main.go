@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"time"
 
@@ -10,7 +11,10 @@ import (
 
 	routes "github.com/IlfGauhnith/GophicProcessor/cmd/api/routes"
 	"github.com/IlfGauhnith/GophicProcessor/pkg/db"
+	events "github.com/IlfGauhnith/GophicProcessor/pkg/events"
 	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	mq "github.com/IlfGauhnith/GophicProcessor/pkg/mq"
+	scheduler "github.com/IlfGauhnith/GophicProcessor/pkg/scheduler"
 	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
 
 	"github.com/gin-gonic/gin"
@@ -34,13 +38,22 @@ func main() {
 	// Initializes db
 	db.InitDB()
 
+	// Initializes the message broker
+	mq.InitBroker()
+
+	// Publishes scheduled jobs once they are due
+	go scheduler.Run(context.Background())
+
+	// Feeds the job event streams
+	go events.Listen(context.Background())
+
 	router := gin.Default()
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{frontendURL},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour, // Browser can cache this config for 12 hours
 	}))
@@ -44,3 +44,32 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// StreamClaimsKey is the context key of the *util.StreamClaims set by StreamTokenMiddleware.
+const StreamClaimsKey = "streamClaims"
+
+// StreamTokenMiddleware checks the stream token of the "token" query parameter.
+// Browsers can't set headers on an EventSource, so the event streams take a
+// short-lived token scoped to them instead of the login token, see util.GenerateStreamToken.
+// A token scoped to a job only opens the stream of that job.
+func StreamTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := util.ValidateStreamToken(c.Query("token"))
+		if err != nil {
+			logger.Log.Warnf("Invalid stream token: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired stream token"})
+			c.Abort()
+			return
+		}
+
+		if claims.JobID != c.Param("jobId") {
+			logger.Log.Warnf("Stream token of job %q used for job %q", claims.JobID, c.Param("jobId"))
+			c.JSON(http.StatusForbidden, gin.H{"error": "Stream token not valid for this stream"})
+			c.Abort()
+			return
+		}
+
+		c.Set(StreamClaimsKey, claims)
+		c.Next()
+	}
+}
@@ -1,8 +1,78 @@
 package model
 
+import (
+	"time"
+
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
 type ResizeRequest struct {
 	Images       []string `json:"images"`
 	Algorithm    string   `json:"algorithm"`
 	TargetWidth  int      `json:"targetWidth"`
 	TargetHeight int      `json:"targetHeight"`
+
+	// Mode is either "resize" (default), "responsive" or "compare".
+	// Responsive jobs produce every width in Widths, or in the named Preset.
+	// Compare jobs resize with every algorithm in Algorithms (all by default).
+	Mode       string   `json:"mode"`
+	Widths     []int    `json:"widths"`
+	Preset     string   `json:"preset"`
+	Algorithms []string `json:"algorithms"`
+
+	// PaletteSize is the number of dominant colors extracted per image.
+	PaletteSize int `json:"paletteSize"`
+
+	// Fit is "stretch" (default), "cover" or "crop".
+	// Gravity positions the cover/crop window: "center" (default),
+	// "north", "south", "east", "west" or "smart" for content-aware crops.
+	Fit     string `json:"fit"`
+	Gravity string `json:"gravity"`
+
+	// Trim removes the uniform border, or transparent margin, of each image
+	// before it is fitted. Nil disables trimming.
+	Trim *model.TrimOptions `json:"trim"`
+
+	// OutputFormat is "jpeg" (default), "png" or "png8", an indexed PNG.
+	// Quantize reduces the colors of the outputs to a generated or fixed palette
+	// with optional dithering, it defaults the output format to "png8".
+	OutputFormat string                 `json:"outputFormat"`
+	Quantize     *model.QuantizeOptions `json:"quantize"`
+
+	// Redactions are regions pixelated, blurred or filled before anything else is done
+	// with the images, see model.Redaction.
+	Redactions []model.Redaction `json:"redactions"`
+
+	// ProtectMask and RemoveMask are base64 images used by the "seamcarve" algorithm.
+	// Seams avoid the white pixels of ProtectMask and go through those of RemoveMask first.
+	ProtectMask string `json:"protectMask"`
+	RemoveMask  string `json:"removeMask"`
+
+	// Priority is "low", "normal" (default) or "high". Low priority jobs wait behind
+	// every other job, high priority ones move ahead of jobs of the same size.
+	Priority string `json:"priority"`
+
+	// RunAt, an RFC 3339 time, holds the job until then instead of queueing it now.
+	RunAt *time.Time `json:"runAt"`
+
+	// CallbackURL receives a signed POST of the outcome once the job is finished.
+	CallbackURL string `json:"callbackUrl"`
+}
+
+type RescheduleRequest struct {
+	RunAt time.Time `json:"runAt" binding:"required"`
+}
+
+type DuplicatesRequest struct {
+	Image string `json:"image"`
+
+	// Hash is one of "ahash", "dhash" or "phash" (default).
+	Hash string `json:"hash"`
+	// MaxDistance is the largest Hamming distance reported as a duplicate.
+	MaxDistance *int `json:"maxDistance"`
+}
+
+type PaletteRequest struct {
+	Image  string `json:"image"`
+	Colors int    `json:"colors"`
 }
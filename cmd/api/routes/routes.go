@@ -24,9 +24,41 @@ func InitRoutes(router *gin.Engine) {
 	{
 		imageRoutes.POST("", handler.PostResizeImagesHandler)
 		imageRoutes.GET("", handler.GetResizeJobHandler)
+		imageRoutes.GET("/scheduled", handler.GetScheduledJobsHandler)
 
 		imageRoutes.GET("/:jobId", handler.GetResizeJobByIDHandler)
+		imageRoutes.DELETE("/:jobId", handler.DeleteResizeJobHandler)
+		imageRoutes.PUT("/:jobId/schedule", handler.PutRescheduleJobHandler)
+		imageRoutes.POST("/:jobId/webhook/redeliver", handler.PostRedeliverWebhookHandler)
+		imageRoutes.GET("/:jobId/duplicates", handler.GetResizeJobDuplicatesHandler)
 
 		imageRoutes.GET("/status/:jobId", handler.GetResizeJobStatusHandler)
+
+		// Stream tokens of the job event streams
+		imageRoutes.POST("/events/token", handler.PostUserJobEventsTokenHandler)
+		imageRoutes.POST("/:jobId/events/token", handler.PostResizeJobEventsTokenHandler)
+	}
+
+	// Job event streams, EventSource clients pass a stream token as a query parameter
+	eventRoutes := router.Group("/resize-images")
+	eventRoutes.Use(middleware.StreamTokenMiddleware())
+	{
+		eventRoutes.GET("/events", handler.GetUserJobEventsHandler)
+		eventRoutes.GET("/:jobId/events", handler.GetResizeJobEventsHandler)
+	}
+
+	// Webhook endpoints
+	webhookRoutes := router.Group("/webhooks")
+	webhookRoutes.Use(middleware.AuthMiddleware())
+	{
+		webhookRoutes.POST("/secret", handler.PostWebhookSecretHandler)
+	}
+
+	// Image analysis endpoints
+	analysisRoutes := router.Group("/images")
+	analysisRoutes.Use(middleware.AuthMiddleware())
+	{
+		analysisRoutes.POST("/duplicates", handler.PostFindDuplicatesHandler)
+		analysisRoutes.POST("/palette", handler.PostPaletteHandler)
 	}
 }
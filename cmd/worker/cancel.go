@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+)
+
+// errJobCancelled is the cause of the context of a job cancelled by its owner.
+var errJobCancelled = errors.New("job cancelled")
+
+const defaultCancelPollInterval = 5 * time.Second
+
+// cancelPollInterval is how often the status of a running job is checked,
+// from JOB_CANCEL_POLL_INTERVAL as a Go duration.
+func cancelPollInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("JOB_CANCEL_POLL_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return defaultCancelPollInterval
+	}
+	return interval
+}
+
+// isCancelled reports whether the owner of a job cancelled it. A job missing
+// from the database, such as one queued by an older API, is never cancelled.
+func isCancelled(ctx context.Context, jobID string) bool {
+	status, err := data_handler.GetResizeJobStatus(ctx, jobID)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Log.Warnf("Failed to check the status of job %s: %v", jobID, err)
+		}
+		return false
+	}
+	return status == "Cancelled"
+}
+
+// watchCancellation polls the status of a job until ctx is done,
+// and cancels ctx with errJobCancelled once the job is cancelled.
+func watchCancellation(ctx context.Context, jobID string, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(cancelPollInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if isCancelled(ctx, jobID) {
+				logger.Log.Infof("Job %s was cancelled, stopping", jobID)
+				cancel(errJobCancelled)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	resize "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/resize"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+const (
+	// isolationProcess, as WORKER_ISOLATION, runs every job in a child process.
+	isolationProcess = "process"
+	// childEnv tells the worker binary it was started as the child of a job.
+	childEnv = "GOPHIC_WORKER_CHILD"
+	// childGracePeriod is how long a child may outlive the job timeout
+	// to report its partial results before it is killed.
+	childGracePeriod = 30 * time.Second
+	// childStopDelay is how long an interrupted child has to report before it is killed.
+	childStopDelay = 10 * time.Second
+)
+
+// childReport is what a child process sends back to the worker. The child sends
+// a report with only Progress set for every progress update, then its final report.
+// Results are partial when the job timed out or was cancelled.
+type childReport struct {
+	Progress  *model.JobProgress  `json:"progress,omitempty"`
+	Results   []model.ImageResult `json:"results"`
+	Error     string              `json:"error,omitempty"`
+	Invalid   bool                `json:"invalid,omitempty"`
+	TimedOut  bool                `json:"timedOut,omitempty"`
+	Cancelled bool                `json:"cancelled,omitempty"`
+	Panic     string              `json:"panic,omitempty"`
+	Stack     string              `json:"stack,omitempty"`
+}
+
+// childError is a child process that died without reporting, usually killed
+// for going over its memory or CPU limits.
+type childError struct {
+	err    error
+	detail string
+}
+
+func (e *childError) Error() string {
+	if e.detail != "" {
+		return fmt.Sprintf("%v: %s", e.err, e.detail)
+	}
+	return e.err.Error()
+}
+
+// resizeInChild processes a job in a child process running this same binary.
+// The job goes through the child's stdin and the report comes back through an
+// extra pipe, so the child's own logs can keep using stdout and stderr.
+// A crash of the child, whatever its cause, only fails this job.
+//
+// The child enforces the job timeout itself. When ctx is done, or childGracePeriod
+// after the timeout, the child is interrupted to report its partial results,
+// and killed if it is still running childStopDelay later.
+func resizeInChild(ctx context.Context, job model.ResizeJob, onProgress resize.ProgressFunc) ([]model.ImageResult, error) {
+	if jobTimeout, _ := resize.Timeouts(); jobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, jobTimeout+childGracePeriod)
+		defer cancel()
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, &childError{err: fmt.Errorf("failed to locate the worker binary: %v", err)}
+	}
+
+	input, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+
+	reportReader, reportWriter, err := os.Pipe()
+	if err != nil {
+		return nil, &childError{err: fmt.Errorf("failed to create the report pipe: %v", err)}
+	}
+	defer reportReader.Close()
+
+	cmd := exec.CommandContext(ctx, executable)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = childStopDelay
+	cmd.Env = append(os.Environ(), childEnv+"=1")
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// The pipe is the child's file descriptor 3.
+	cmd.ExtraFiles = []*os.File{reportWriter}
+
+	if err := cmd.Start(); err != nil {
+		reportWriter.Close()
+		return nil, &childError{err: fmt.Errorf("failed to start the child process: %v", err)}
+	}
+	// Only the child holds the write end now, reading stops when it exits.
+	reportWriter.Close()
+
+	var report childReport
+	reported := false
+	decoder := json.NewDecoder(reportReader)
+	for {
+		var message childReport
+		if err := decoder.Decode(&message); err != nil {
+			break
+		}
+		if message.Progress != nil {
+			onProgress(*message.Progress)
+			continue
+		}
+		report = message
+		reported = true
+	}
+	waitErr := cmd.Wait()
+
+	if !reported {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("child process killed: %w", err)
+		}
+		if waitErr == nil {
+			waitErr = fmt.Errorf("child process exited without a report")
+		}
+		var detail string
+		if cmd.ProcessState != nil {
+			detail = cmd.ProcessState.String()
+		}
+		return nil, &childError{err: waitErr, detail: detail}
+	}
+
+	switch {
+	case report.Panic != "":
+		return nil, &panicError{value: report.Panic, stack: report.Stack}
+	case report.TimedOut:
+		return report.Results, fmt.Errorf("%s: %w", report.Error, context.DeadlineExceeded)
+	case report.Cancelled:
+		return report.Results, fmt.Errorf("%s: %w", report.Error, context.Canceled)
+	case report.Invalid:
+		return nil, &resize.InvalidJobError{Err: errors.New(report.Error)}
+	case report.Error != "":
+		return nil, fmt.Errorf("%s", report.Error)
+	}
+	return report.Results, nil
+}
+
+// runChild is the entry point of a child process: it applies the resource limits,
+// reads the job from stdin and writes its report to file descriptor 3.
+// An interrupt stops the job like a cancellation.
+func runChild() {
+	report := os.NewFile(3, "report")
+	if report == nil {
+		logger.Log.Fatal("Child process started without a report pipe")
+	}
+	defer report.Close()
+
+	applyChildLimits()
+
+	var job model.ResizeJob
+	if err := json.NewDecoder(os.Stdin).Decode(&job); err != nil {
+		writeReport(report, childReport{Error: fmt.Sprintf("failed to read job: %v", err)})
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results, err := resizeSafely(ctx, job, func(progress model.JobProgress) {
+		writeReport(report, childReport{Progress: &progress})
+	})
+	var panicErr *panicError
+	var invalidErr *resize.InvalidJobError
+	switch {
+	case err == nil:
+		writeReport(report, childReport{Results: results})
+	case errors.As(err, &invalidErr):
+		writeReport(report, childReport{Error: invalidErr.Error(), Invalid: true})
+	case errors.As(err, &panicErr):
+		writeReport(report, childReport{Panic: panicErr.value, Stack: panicErr.stack})
+	case errors.Is(err, context.DeadlineExceeded):
+		writeReport(report, childReport{Results: results, Error: err.Error(), TimedOut: true})
+	case errors.Is(err, context.Canceled):
+		writeReport(report, childReport{Results: results, Error: err.Error(), Cancelled: true})
+	default:
+		writeReport(report, childReport{Error: err.Error()})
+	}
+}
+
+func writeReport(w io.Writer, report childReport) {
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.Log.Errorf("Failed to write child report: %v", err)
+	}
+}
+
+// applyChildLimits caps the address space (WORKER_CHILD_MAX_MEMORY_MB) and the
+// CPU time (WORKER_CHILD_MAX_CPU_SECONDS) of the child process. The Go memory limit
+// is set a bit lower so the garbage collector works harder before the hard limit hits.
+func applyChildLimits() {
+	if mb, err := strconv.ParseUint(os.Getenv("WORKER_CHILD_MAX_MEMORY_MB"), 10, 64); err == nil && mb > 0 {
+		limit := mb << 20
+		debug.SetMemoryLimit(int64(limit / 10 * 8))
+		if err := setMemoryLimit(limit); err != nil {
+			logger.Log.Warnf("Failed to limit child memory: %v", err)
+		}
+	}
+
+	if seconds, err := strconv.ParseUint(os.Getenv("WORKER_CHILD_MAX_CPU_SECONDS"), 10, 64); err == nil && seconds > 0 {
+		if err := setCPULimit(seconds); err != nil {
+			logger.Log.Warnf("Failed to limit child CPU time: %v", err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	resize "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/resize"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+	webhook "github.com/IlfGauhnith/GophicProcessor/pkg/webhook"
+)
+
+// errorCodeInternal marks jobs that failed because of a bug or a crash rather than their input.
+const errorCodeInternal = "internal_error"
+
+// saveAttempts is how many times the outcome of a job is written before giving up,
+// the database may be unavailable for a moment.
+const saveAttempts = 3
+
+// saveRetryDelay is the wait before the second attempt, doubled before each next one.
+var saveRetryDelay = time.Second
+
+// Panic metrics, published by expvar on /debug/vars of the pprof server.
+var (
+	jobPanics     = expvar.NewInt("worker_job_panics")
+	childCrashes  = expvar.NewInt("worker_child_crashes")
+	failedJobs    = expvar.NewInt("worker_failed_jobs")
+	timedOutJobs  = expvar.NewInt("worker_timed_out_jobs")
+	cancelledJobs = expvar.NewInt("worker_cancelled_jobs")
+	lastPanic     = expvar.NewString("worker_last_panic")
+)
+
+// panicError is a panic recovered while processing a job.
+type panicError struct {
+	value string
+	stack string
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %s", e.value)
+}
+
+// resizeSafely runs resize.ResizeImages, turning a panic into a *panicError
+// so that one broken input can't take down the whole worker.
+func resizeSafely(ctx context.Context, job model.ResizeJob, onProgress resize.ProgressFunc) (results []model.ImageResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{value: fmt.Sprint(r), stack: string(debug.Stack())}
+		}
+	}()
+
+	return resize.ResizeImages(ctx, job, onProgress)
+}
+
+// processJob resizes the images of a job, in this process or in a child process
+// depending on WORKER_ISOLATION, and saves the outcome. A job running out of time
+// is failed, and a job cancelled by its owner stopped, with the results of the
+// images processed until then.
+func processJob(ctx context.Context, job model.ResizeJob) {
+	// Saving the outcome can panic too, the worker must survive it as well.
+	defer func() {
+		if r := recover(); r != nil {
+			recordPanic(job, &panicError{value: fmt.Sprint(r), stack: string(debug.Stack())})
+			failJob(job, errorCodeInternal, "internal error while processing the job")
+		}
+	}()
+
+	if isCancelled(ctx, job.JobID) {
+		cancelledJobs.Add(1)
+		logger.Log.Infof("Skipping job %s, it was cancelled while queued", job.JobID)
+		job.Images = []string{}
+		job.Status = "Cancelled"
+		notify(ctx, job)
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go watchCancellation(ctx, job.JobID, cancel)
+
+	progress := newProgressRecorder(ctx, job.JobID)
+
+	var results []model.ImageResult
+	var err error
+	if os.Getenv("WORKER_ISOLATION") == isolationProcess {
+		results, err = resizeInChild(ctx, job, progress.record)
+	} else {
+		results, err = resizeSafely(ctx, job, progress.record)
+	}
+	// The final update may have been skipped by the interval, whatever the outcome.
+	progress.flush()
+
+	var panicErr *panicError
+	var childErr *childError
+	var invalidErr *resize.InvalidJobError
+	switch {
+	case err == nil:
+		job.Status = "Completed"
+	case errors.Is(context.Cause(ctx), errJobCancelled):
+		cancelledJobs.Add(1)
+		logger.Log.Infof("Job %s stopped after its cancellation", job.JobID)
+		job.Status = "Cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		timedOutJobs.Add(1)
+		failedJobs.Add(1)
+		logger.Log.Warnf("Job %s timed out: %v", job.JobID, err)
+		job.Status = "Failed"
+		job.ErrorCode = resize.CodeTimeout
+		job.Error = "the job took too long to process"
+	case errors.As(err, &panicErr):
+		recordPanic(job, panicErr)
+		failJob(job, errorCodeInternal, "internal error while processing the job")
+		return
+	case errors.As(err, &childErr):
+		childCrashes.Add(1)
+		logger.Log.Errorf("Child process of job %s failed: %v", job.JobID, childErr)
+		failJob(job, errorCodeInternal, "internal error while processing the job")
+		return
+	case errors.As(err, &invalidErr):
+		logger.Log.Warnf("Rejected job %s: %v", job.JobID, invalidErr)
+		failJob(job, resize.CodeInvalidJob, invalidErr.Error())
+		return
+	default:
+		logger.Log.Errorf("Error processing job %s: %v", job.JobID, err)
+		failJob(job, errorCodeInternal, "internal error while processing the job")
+		return
+	}
+
+	// The job context may be done by now, the outcome is saved regardless.
+	ctx = context.WithoutCancel(ctx)
+
+	// Images carried the base64 inputs until now,
+	// from here on it holds the output URLs.
+	job.Images = make([]string, len(results))
+	for i, result := range results {
+		job.Images[i] = result.URL
+	}
+	job.Results = results
+	if err := retrySave(func() error { return data_handler.SaveResizeJob(ctx, job) }); err != nil {
+		logger.Log.Errorf("Failed to save the results of job %s: %v", job.JobID, err)
+		failJob(job, errorCodeInternal, "internal error while saving the job results")
+		return
+	}
+	notify(ctx, job)
+
+	// The job is done without its hashes, it only can't be found as a duplicate.
+	for _, result := range results {
+		if result.Hashes == nil {
+			continue
+		}
+		record := model.ImageHashRecord{
+			JobID:      job.JobID,
+			ImageIndex: result.Index,
+			ImageURL:   result.URL,
+			Hashes:     *result.Hashes,
+		}
+		if err := retrySave(func() error { return data_handler.SaveImageHashes(ctx, job.OwnerID, record) }); err != nil {
+			logger.Log.Errorf("Failed to save the hashes of image %d of job %s: %v", result.Index, job.JobID, err)
+		}
+	}
+
+	logger.Log.Infof("Job %s %s with %d images processed", job.JobID, strings.ToLower(job.Status), len(results))
+}
+
+func recordPanic(job model.ResizeJob, e *panicError) {
+	jobPanics.Add(1)
+	lastPanic.Set(fmt.Sprintf("%s job %s: %s", time.Now().UTC().Format(time.RFC3339), job.JobID, e.value))
+	logger.Log.Errorf("Recovered from panic in job %s: %s\n%s", job.JobID, e.value, e.stack)
+}
+
+// failJob marks a job as failed. The details of internal errors stay in the
+// logs, clients only get the code and a generic message.
+func failJob(job model.ResizeJob, code string, message string) {
+	failedJobs.Add(1)
+
+	// Never store the base64 inputs in place of the output URLs.
+	job.Images = []string{}
+	job.Results = nil
+	job.Status = "Failed"
+	job.ErrorCode = code
+	job.Error = message
+
+	if err := retrySave(func() error { return data_handler.SaveResizeJob(context.Background(), job) }); err != nil {
+		logger.Log.Errorf("Failed to mark job %s as failed: %v", job.JobID, err)
+	}
+	notify(context.Background(), job)
+}
+
+// retrySave calls save until it succeeds, up to saveAttempts times, and returns
+// the error of the last attempt.
+func retrySave(save func() error) error {
+	delay := saveRetryDelay
+	var err error
+	for attempt := 1; attempt <= saveAttempts; attempt++ {
+		if err = save(); err == nil {
+			return nil
+		}
+		if attempt < saveAttempts {
+			logger.Log.Warnf("Save attempt %d of %d failed, retrying in %s: %v", attempt, saveAttempts, delay, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+// notify queues the webhook of a finished job, if it has a callback URL.
+func notify(ctx context.Context, job model.ResizeJob) {
+	if err := webhook.Enqueue(ctx, job); err != nil {
+		logger.Log.Errorf("Failed to enqueue webhook of job %s: %v", job.JobID, err)
+	}
+}
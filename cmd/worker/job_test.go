@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRetrySave(t *testing.T) {
+	saveRetryDelay = 0
+
+	errDown := errors.New("database is down")
+	tests := []struct {
+		name      string
+		failures  int
+		wantErr   bool
+		wantCalls int
+	}{
+		{"first attempt", 0, false, 1},
+		{"after a failure", 1, false, 2},
+		{"on the last attempt", saveAttempts - 1, false, saveAttempts},
+		{"never", saveAttempts, true, saveAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retrySave(func() error {
+				calls++
+				if calls <= tt.failures {
+					return errDown
+				}
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retrySave() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, errDown) {
+				t.Fatalf("retrySave() = %v, want %v", err, errDown)
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("save called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
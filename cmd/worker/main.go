@@ -3,45 +3,62 @@ package main
 import (
 	_ "net/http/pprof"
 
+	"context"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"runtime"
 	"sync"
 
 	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
 	db "github.com/IlfGauhnith/GophicProcessor/pkg/db"
-	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
-	resize "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/resize"
 	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
-	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
 	mq "github.com/IlfGauhnith/GophicProcessor/pkg/mq"
-	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
+	webhook "github.com/IlfGauhnith/GophicProcessor/pkg/webhook"
 )
 
 func main() {
+	// Started by resizeInChild to process a single job in isolation.
+	if os.Getenv(childEnv) == "1" {
+		runChild()
+		return
+	}
+
 	logger.Log.Info("Worker started")
 
+	// Health of the worker, served along with pprof
+	http.HandleFunc("/health", healthHandler)
+
 	// Starting pprof server
 	go func() {
 		logger.Log.Info("Starting pprof on :6060")
 		http.ListenAndServe(":6060", nil)
 	}()
 
-	// Run shutdown signal handling in a separate goroutine
-	// for clean shutdown
-	go util.WaitForShutdown()
+	// A shutdown signal stops the consumption of the queue, the jobs being
+	// processed are finished before the worker exits.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Initializes db
 	db.InitDB()
 
+	// Initializes the message broker
+	mq.InitBroker()
+
+	// Sends the callbacks of finished jobs
+	go webhook.Run(context.Background())
+
 	// This ensures the application fully utilizes all CPU cores.
 	// This is important for the worker to be able to process multiple jobs concurrently.
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	logger.Log.Infof("Number of CPUs: %d", runtime.NumCPU())
 
-	// Creates a channel of type model.ResizeJob to communicate
+	// Creates a channel of type mq.ResizeJobDelivery to communicate
 	// job data between goroutines.
-	jobs := make(chan model.ResizeJob)
+	jobs := make(chan mq.ResizeJobDelivery)
 
 	// Initializes a wait group to keep track of running goroutines
 	// and ensure the application waits for their completion.
@@ -66,16 +83,12 @@ func main() {
 			// The for job := range jobs loop will block and wait if the channel is empty.
 			// The goroutine will not consume any CPU while waiting.
 			// As soon as a new job arrives in the channel, the goroutine immediately picks it up and processes it.
-			for job := range jobs {
-				if imgs, err := resize.ResizeImages(job); err != nil {
-					logger.Log.Warnf("Error processing job %s: %v", job.JobID, err)
-				} else {
-
-					job.Images = imgs
-					job.Status = "Completed"
-					data_handler.SaveResizeJob(job)
-
-					logger.Log.Infof("Job %s completed with %d images processed", job.JobID, len(imgs))
+			// The job is acknowledged once processed, so that the broker delivers it
+			// again if the worker dies in the middle of it.
+			for delivery := range jobs {
+				processJob(context.Background(), delivery.Job)
+				if err := delivery.Ack(); err != nil {
+					logger.Log.Warnf("Failed to acknowledge job %s: %v", delivery.Job.JobID, err)
 				}
 			}
 		}()
@@ -84,8 +97,25 @@ func main() {
 	// If the consumer (mq.ConsumeResizeJobs) tries to push jobs
 	// to the channel before workers are ready,
 	// it will block and potentially cause a deadlock.
-	mq.ConsumeResizeJobs(jobs)
+	if err := mq.ConsumeResizeJobs(ctx, jobs, runtime.NumCPU()); err != nil {
+		logger.Log.Fatalf("Failed to consume jobs: %v", err)
+	}
+	// The consumer returns on shutdown or once the broker is closed, the workers finish their jobs.
+	close(jobs)
 
 	// Ensures that the program does not exit before all jobs are handled.
 	wg.Wait()
+
+	mq.CloseBroker()
+	db.CloseDB()
+	logger.Log.Info("Worker stopped")
+}
+
+// healthHandler answers 503 while the worker can't receive jobs from the broker.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if err := mq.Health(); err != nil {
+		http.Error(w, "broker: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+const defaultProgressInterval = time.Second
+
+// saveProgress records the progress of a job, replaced in tests.
+var saveProgress = data_handler.UpdateResizeJobProgress
+
+// progressInterval is the shortest time between two progress updates of a job,
+// from PROGRESS_MIN_INTERVAL as a Go duration.
+func progressInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("PROGRESS_MIN_INTERVAL"))
+	if err != nil || interval < 0 {
+		return defaultProgressInterval
+	}
+	return interval
+}
+
+// progressRecorder saves the progress of a job at most once per progressInterval.
+// The updates skipped in between are only kept until flush saves the last one.
+type progressRecorder struct {
+	ctx      context.Context
+	jobID    string
+	interval time.Duration
+
+	last time.Time
+	// pending is the last update not saved yet.
+	pending *model.JobProgress
+}
+
+func newProgressRecorder(ctx context.Context, jobID string) *progressRecorder {
+	return &progressRecorder{
+		// The final update comes after a cancellation or a timeout too.
+		ctx:      context.WithoutCancel(ctx),
+		jobID:    jobID,
+		interval: progressInterval(),
+	}
+}
+
+// record is the progress callback of the job. The first update is always saved.
+func (r *progressRecorder) record(progress model.JobProgress) {
+	r.pending = &progress
+	if time.Since(r.last) < r.interval {
+		return
+	}
+	r.flush()
+}
+
+// flush saves the last update if it was skipped. It is called once the job is
+// over, so that its final progress is recorded whatever the interval.
+func (r *progressRecorder) flush() {
+	if r.pending == nil {
+		return
+	}
+	progress := *r.pending
+	r.pending = nil
+	r.last = time.Now()
+
+	if err := saveProgress(r.ctx, r.jobID, progress); err != nil {
+		logger.Log.Warnf("Failed to record progress of job %s: %v", r.jobID, err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+func TestProgressRecorder(t *testing.T) {
+	tests := []struct {
+		name      string
+		interval  time.Duration
+		processed []int
+		// saved are the updates saved while recording, final the ones after flush.
+		saved []int
+		final []int
+	}{
+		{"no updates", time.Hour, nil, nil, nil},
+		{"no interval", 0, []int{0, 1, 2}, []int{0, 1, 2}, []int{0, 1, 2}},
+		{"throttled", time.Hour, []int{0, 1, 2}, []int{0}, []int{0, 2}},
+		{"stopped early", time.Hour, []int{0, 1}, []int{0}, []int{0, 1}},
+		{"only the first", time.Hour, []int{0}, []int{0}, []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved []int
+			saveProgress = func(_ context.Context, _ string, progress model.JobProgress) error {
+				saved = append(saved, progress.Processed)
+				return nil
+			}
+			r := newProgressRecorder(context.Background(), "job")
+			r.interval = tt.interval
+
+			for _, processed := range tt.processed {
+				r.record(model.JobProgress{Total: 2, Processed: processed})
+			}
+			if !slices.Equal(saved, tt.saved) {
+				t.Fatalf("saved %v while recording, want %v", saved, tt.saved)
+			}
+			r.flush()
+			r.flush()
+			if !slices.Equal(saved, tt.final) {
+				t.Fatalf("saved %v after flush, want %v", saved, tt.final)
+			}
+		})
+	}
+}
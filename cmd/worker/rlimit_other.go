@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "fmt"
+
+func setMemoryLimit(bytes uint64) error {
+	return fmt.Errorf("resource limits are not supported on this platform")
+}
+
+func setCPULimit(seconds uint64) error {
+	return fmt.Errorf("resource limits are not supported on this platform")
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+func setMemoryLimit(bytes uint64) error {
+	return syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: bytes, Max: bytes})
+}
+
+func setCPULimit(seconds uint64) error {
+	return syscall.Setrlimit(syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: seconds, Max: seconds})
+}
@@ -4,7 +4,7 @@ import { Box, Card, Inset, Separator, Text, Flex, Select, IconButton, Spinner }
 import Image from "next/image";
 import React, { useState } from "react";
 import { EnterIcon, DownloadIcon } from "@radix-ui/react-icons";
-import { sendJob, pollJobStatus, getJobResult } from "../../service/resizeService";
+import { sendJob, watchJobStatus, getJobResult } from "../../service/resizeService";
 import classNames from "classnames";
 import styles from "../../styles/ResizeImageJobCard.module.css"
 
@@ -95,7 +95,7 @@ export default function ResizeImageJobCard({
       const jobId = result.job_id;
 
 
-      const uuidFetched = await pollJobStatus(jobId);
+      const uuidFetched = await watchJobStatus(jobId);
       setJobAPIuuid(uuidFetched);
 
       // Once the job is complete, update the state.
@@ -103,6 +103,96 @@ export async function pollJobStatus(
   }
 }
 
+interface JobEvent {
+  job_id: string;
+  status: string;
+  progress?: {
+    total: number;
+    processed: number;
+    failed: number;
+    current: number;
+    etaSeconds?: number;
+  };
+  errorCode?: string;
+}
+
+/**
+ * Requests a short-lived token opening the event stream of a job.
+ * EventSource can't send the Authorization header, the stream token goes in the URL instead.
+ */
+async function getJobEventsToken(jobId: string): Promise<string> {
+  const token = localStorage.getItem("authToken");
+
+  const response = await fetch(`${apiUrl}/resize-images/${jobId}/events/token`, {
+    method: "POST",
+    headers: {
+      "Authorization": `Bearer ${token}`,
+    },
+  });
+
+  if (!response.ok) {
+    throw new Error("Stream token request failed.");
+  }
+
+  const data: { token: string } = await response.json();
+  return data.token;
+}
+
+/**
+ * Waits for a job to complete through its Server-Sent Events stream,
+ * calling onEvent for every status or progress change.
+ * Falls back to polling when the stream can't be opened.
+ */
+export function watchJobStatus(
+  jobId: string,
+  onEvent?: (event: JobEvent) => void
+): Promise<string> {
+  return new Promise((resolve, reject) => {
+    const fallBack = () => pollJobStatus(jobId).then(resolve, reject);
+
+    const connect = async () => {
+      let streamToken: string;
+      try {
+        streamToken = await getJobEventsToken(jobId);
+      } catch {
+        fallBack();
+        return;
+      }
+
+      const url = `${apiUrl}/resize-images/${jobId}/events?token=${encodeURIComponent(streamToken)}`;
+      const source = new EventSource(url);
+      let received = false;
+
+      source.addEventListener("job", (message) => {
+        received = true;
+        const event: JobEvent = JSON.parse((message as MessageEvent).data);
+        onEvent?.(event);
+
+        if (event.status === "Completed") {
+          source.close();
+          resolve(jobId);
+        } else if (event.status === "Failed" || event.status === "Cancelled") {
+          source.close();
+          reject(new Error(`Job ${event.status.toLowerCase()}`));
+        }
+      });
+
+      source.onerror = () => {
+        source.close();
+        // Stream tokens expire quickly, a stream that worked is opened again with a
+        // new token and starts over from the current state of the job.
+        if (received) {
+          connect();
+          return;
+        }
+        fallBack();
+      };
+    };
+
+    connect();
+  });
+}
+
 export async function getJobResult(jobId: string): Promise<{ images: string[] }> {
   const token = localStorage.getItem("authToken");
 
@@ -0,0 +1,115 @@
+package data_handler
+
+import (
+	"context"
+	"time"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+
+	db "github.com/IlfGauhnith/GophicProcessor/pkg/db"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// ReserveIdempotencyKey binds key of ownerID to jobID for ttl, unless the key is
+// already bound. It returns the binding in place and whether it is the new one.
+// A new binding is pending until CompleteIdempotencyKey, or until pendingTimeout
+// for a submission that died meanwhile. Expired keys of ownerID are dropped first,
+// their key can be used again.
+func ReserveIdempotencyKey(ctx context.Context, ownerID int, key model.IdempotencyKey, ttl time.Duration, pendingTimeout time.Duration) (model.IdempotencyKey, bool, error) {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return model.IdempotencyKey{}, false, err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `
+    DELETE FROM tb_idempotency_key
+    WHERE owner_id = $1
+        AND (expires_at <= NOW() OR (pending AND created_at <= NOW() - $2::bigint * INTERVAL '1 millisecond'));
+    `, ownerID, pendingTimeout.Milliseconds())
+	if err != nil {
+		logger.Log.Errorf("Failed to delete expired idempotency keys: %v", err)
+		return model.IdempotencyKey{}, false, err
+	}
+
+	// The binding is committed right away, a concurrent submission with the same
+	// key finds it pending until the job is created.
+	reserved := key
+	reserved.Pending = true
+	err = conn.QueryRow(ctx, `
+    INSERT INTO tb_idempotency_key (owner_id, idempotency_key, fingerprint, resize_job_uuid, expires_at, pending)
+    VALUES ($1, $2, $3, $4, NOW() + $5::bigint * INTERVAL '1 millisecond', TRUE)
+    ON CONFLICT (owner_id, idempotency_key) DO NOTHING
+    RETURNING expires_at;
+    `, ownerID, key.Key, key.Fingerprint, key.JobID, ttl.Milliseconds()).Scan(&reserved.ExpiresAt)
+	if err == nil {
+		return reserved, true, nil
+	}
+	if err != pgx.ErrNoRows {
+		logger.Log.Errorf("Failed to reserve idempotency key: %v", err)
+		return model.IdempotencyKey{}, false, err
+	}
+
+	existing := model.IdempotencyKey{Key: key.Key}
+	err = conn.QueryRow(ctx, `
+    SELECT fingerprint, resize_job_uuid, expires_at, pending
+    FROM tb_idempotency_key
+    WHERE owner_id = $1 AND idempotency_key = $2;
+    `, ownerID, key.Key).Scan(&existing.Fingerprint, &existing.JobID, &existing.ExpiresAt, &existing.Pending)
+	if err != nil {
+		logger.Log.Errorf("Failed to get idempotency key: %v", err)
+		return model.IdempotencyKey{}, false, err
+	}
+
+	return existing, false, nil
+}
+
+// CompleteIdempotencyKey ends the pending state of key of ownerID once its job is
+// created, the retries get the job from then on.
+func CompleteIdempotencyKey(ctx context.Context, ownerID int, key string) error {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `
+    UPDATE tb_idempotency_key
+    SET pending = FALSE
+    WHERE owner_id = $1 AND idempotency_key = $2;
+    `, ownerID, key)
+	if err != nil {
+		logger.Log.Errorf("Failed to complete idempotency key: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey frees key of ownerID, for a submission that didn't create its job.
+func ReleaseIdempotencyKey(ctx context.Context, ownerID int, key string) error {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `
+    DELETE FROM tb_idempotency_key
+    WHERE owner_id = $1 AND idempotency_key = $2;
+    `, ownerID, key)
+	if err != nil {
+		logger.Log.Errorf("Failed to release idempotency key: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package data_handler
+
+import (
+	"context"
+	"fmt"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+
+	db "github.com/IlfGauhnith/GophicProcessor/pkg/db"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// SaveImageHashes stores the perceptual hashes of one input image of a job.
+// Hashes are unsigned 64 bit values stored in BIGINT columns,
+// so they are converted to int64 keeping the same bits.
+func SaveImageHashes(ctx context.Context, ownerID int, record model.ImageHashRecord) error {
+	query := `
+    INSERT INTO tb_image_hash (owner_id, resize_job_uuid, image_index, image_url, ahash, dhash, phash)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    ON CONFLICT (resize_job_uuid, image_index) DO UPDATE
+    SET image_url = $4, ahash = $5, dhash = $6, phash = $7;
+    `
+
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, query,
+		ownerID,
+		record.JobID,
+		record.ImageIndex,
+		record.ImageURL,
+		int64(record.Hashes.AHash),
+		int64(record.Hashes.DHash),
+		int64(record.Hashes.PHash),
+	)
+	if err != nil {
+		logger.Log.Errorf("Failed to save image hashes: %v", err)
+		return err
+	}
+
+	logger.Log.Infof("Successfully saved hashes of image %d for job ID: %s", record.ImageIndex, record.JobID)
+	return nil
+}
+
+// GetImageHashesByJob retrieves the hashes of the images of a job of ownerID.
+func GetImageHashesByJob(ctx context.Context, jobID string, ownerID int) ([]model.ImageHashRecord, error) {
+	logger.Log.Infof("Getting image hashes for job ID: %s", jobID)
+
+	query := `
+		SELECT resize_job_uuid, image_index, COALESCE(image_url, ''), ahash, dhash, phash, created_at
+		FROM tb_image_hash
+		WHERE resize_job_uuid = $1 AND owner_id = $2
+		ORDER BY image_index;
+	`
+	return queryImageHashes(ctx, query, jobID, ownerID)
+}
+
+// FindSimilarImageHashes retrieves the hashes of the images of ownerID whose hashKind
+// hash, "ahash", "dhash" or "phash", is within maxDistance bits of hash. The distance
+// is computed by Postgres, only the matches are loaded.
+func FindSimilarImageHashes(ctx context.Context, ownerID int, hashKind string, hash uint64, maxDistance int) ([]model.ImageHashRecord, error) {
+	logger.Log.Infof("Finding similar image hashes for owner_id: %d", ownerID)
+
+	switch hashKind {
+	case "ahash", "dhash", "phash":
+	default:
+		return nil, fmt.Errorf("unknown hash: %s", hashKind)
+	}
+
+	// The differing bits are counted from the text of the XOR, bit_count
+	// needs Postgres 14.
+	query := fmt.Sprintf(`
+		SELECT resize_job_uuid, image_index, COALESCE(image_url, ''), ahash, dhash, phash, created_at
+		FROM tb_image_hash
+		WHERE owner_id = $1
+			AND length(replace((%s # $2)::bit(64)::text, '0', '')) <= $3
+		ORDER BY created_at;
+	`, hashKind)
+	return queryImageHashes(ctx, query, ownerID, int64(hash), maxDistance)
+}
+
+// queryImageHashes runs a query selecting image hash records.
+func queryImageHashes(ctx context.Context, query string, args ...any) ([]model.ImageHashRecord, error) {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return nil, err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		logger.Log.Errorf("Failed to query image hashes: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []model.ImageHashRecord
+
+	for rows.Next() {
+		var record model.ImageHashRecord
+		var ahash, dhash, phash int64
+
+		err = rows.Scan(&record.JobID, &record.ImageIndex, &record.ImageURL, &ahash, &dhash, &phash, &record.CreatedAt)
+		if err != nil {
+			logger.Log.Errorf("Error scanning row: %v", err)
+			return nil, err
+		}
+
+		record.Hashes = model.ImageHashes{
+			AHash: uint64(ahash),
+			DHash: uint64(dhash),
+			PHash: uint64(phash),
+		}
+		records = append(records, record)
+	}
+
+	if err = rows.Err(); err != nil {
+		logger.Log.Errorf("Error iterating over rows: %v", err)
+		return nil, err
+	}
+
+	logger.Log.Infof("Successfully retrieved %d image hashes", len(records))
+	return records, nil
+}
@@ -12,16 +12,18 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
-// SaveJobResult saves the result of a job to the database
-func SaveResizeJob(resizeJob model.ResizeJob) error {
+// SaveResizeJob saves a job and its results to the database.
+// A cancelled job stays cancelled, only its results are updated.
+func SaveResizeJob(ctx context.Context, resizeJob model.ResizeJob) error {
 	query := `
-    INSERT INTO tb_resize_job (resize_job_uuid, status, imgs_urls, algorithm, owner_id)
-    VALUES ($1, $2, $3, $4, $5)
+    INSERT INTO tb_resize_job (resize_job_uuid, status, imgs_urls, algorithm, owner_id, mode, results, error_code, error_message, callback_url)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''))
     ON CONFLICT (resize_job_uuid) DO UPDATE
-    SET status = $2, imgs_urls = $3;
+    SET status = CASE WHEN tb_resize_job.status = 'Cancelled' THEN tb_resize_job.status ELSE $2 END,
+        imgs_urls = $3, results = $7, error_code = NULLIF($8, ''), error_message = NULLIF($9, '');
     `
 
-	conn, err := db.GetDB().Acquire(context.Background())
+	conn, err := db.GetDB().Acquire(ctx)
 	if err != nil {
 		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
 		return err
@@ -29,7 +31,17 @@ func SaveResizeJob(resizeJob model.ResizeJob) error {
 	logger.Log.Info("DB connection successfully acquired.")
 	defer conn.Release()
 
-	_, err = conn.Exec(context.Background(), query, resizeJob.JobID, resizeJob.Status, resizeJob.Images, resizeJob.Algorithm, resizeJob.OwnerID)
+	mode := resizeJob.Mode
+	if mode == "" {
+		mode = "resize"
+	}
+
+	results := resizeJob.Results
+	if results == nil {
+		results = []model.ImageResult{}
+	}
+
+	_, err = conn.Exec(ctx, query, resizeJob.JobID, resizeJob.Status, resizeJob.Images, resizeJob.Algorithm, resizeJob.OwnerID, mode, results, resizeJob.ErrorCode, resizeJob.Error, resizeJob.CallbackURL)
 	if err != nil {
 		logger.Log.Errorf("Failed to save resize job result: %v", err)
 		return err
@@ -39,13 +51,14 @@ func SaveResizeJob(resizeJob model.ResizeJob) error {
 	return nil
 }
 
-func GetResizeJob(jobID string) (*model.ResizeJob, error) {
+func GetResizeJob(ctx context.Context, jobID string) (*model.ResizeJob, error) {
 	query := `
-    SELECT resize_job_uuid, status, imgs_urls, algorithm, owner_id, resize_job_id 
+    SELECT resize_job_uuid, status, imgs_urls, algorithm, owner_id, resize_job_id, mode, results,
+        COALESCE(error_code, ''), COALESCE(error_message, ''), progress, COALESCE(callback_url, '')
     FROM tb_resize_job
     WHERE resize_job_uuid = $1;
     `
-	conn, err := db.GetDB().Acquire(context.Background())
+	conn, err := db.GetDB().Acquire(ctx)
 	if err != nil {
 		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
 		return nil, err
@@ -53,10 +66,12 @@ func GetResizeJob(jobID string) (*model.ResizeJob, error) {
 	logger.Log.Info("DB connection successfully acquired.")
 	defer conn.Release()
 
-	var jobIDResult, status, algorithm string
+	var jobIDResult, status, algorithm, mode, errorCode, errorMessage, callbackURL string
 	var images []string
+	var results []model.ImageResult
+	var progress *model.JobProgress
 	var ownerID, resizeJobID int
-	err = conn.QueryRow(context.Background(), query, jobID).Scan(&jobIDResult, &status, &images, &algorithm, &ownerID, &resizeJobID)
+	err = conn.QueryRow(ctx, query, jobID).Scan(&jobIDResult, &status, &images, &algorithm, &ownerID, &resizeJobID, &mode, &results, &errorCode, &errorMessage, &progress, &callbackURL)
 	if err == pgx.ErrNoRows {
 		logger.Log.Warnf("No resize job found with ID: %s", jobID)
 		return nil, fmt.Errorf("resize job not found")
@@ -67,12 +82,18 @@ func GetResizeJob(jobID string) (*model.ResizeJob, error) {
 
 	// Construct the ResizeJob object
 	job := &model.ResizeJob{
-		JobID:     jobIDResult,
-		Status:    status,
-		Images:    images,
-		Algorithm: algorithm,
-		OwnerID:   ownerID,
-		Id:        resizeJobID,
+		JobID:       jobIDResult,
+		Status:      status,
+		Images:      images,
+		Algorithm:   algorithm,
+		OwnerID:     ownerID,
+		Id:          resizeJobID,
+		Mode:        mode,
+		Results:     results,
+		Progress:    progress,
+		CallbackURL: callbackURL,
+		ErrorCode:   errorCode,
+		Error:       errorMessage,
 	}
 
 	logger.Log.Infof("Successfully retrieved resize job for job ID: %s", jobID)
@@ -80,13 +101,13 @@ func GetResizeJob(jobID string) (*model.ResizeJob, error) {
 }
 
 // UpdateJobStatus updates the status of an existing job
-func UpdateResizeJobStatus(jobID, status string) error {
+func UpdateResizeJobStatus(ctx context.Context, jobID, status string) error {
 	query := `
     UPDATE tb_resize_job
     SET status = $1
     WHERE resize_job_uuid = $2;
     `
-	conn, err := db.GetDB().Acquire(context.Background())
+	conn, err := db.GetDB().Acquire(ctx)
 	if err != nil {
 		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
 		return err
@@ -94,7 +115,7 @@ func UpdateResizeJobStatus(jobID, status string) error {
 	logger.Log.Info("DB connection successfully acquired.")
 	defer conn.Release()
 
-	_, err = conn.Exec(context.Background(), query, status, jobID)
+	_, err = conn.Exec(ctx, query, status, jobID)
 	if err != nil {
 		logger.Log.Errorf("Failed to update resize job status: %v", err)
 		return err
@@ -104,11 +125,118 @@ func UpdateResizeJobStatus(jobID, status string) error {
 	return nil
 }
 
+// UpdateResizeJobProgress records the progress of a job. Workers call it
+// for every image, so it stays quiet on success.
+func UpdateResizeJobProgress(ctx context.Context, jobID string, progress model.JobProgress) error {
+	query := `
+    UPDATE tb_resize_job
+    SET progress = $1
+    WHERE resize_job_uuid = $2;
+    `
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, query, progress, jobID)
+	if err != nil {
+		logger.Log.Errorf("Failed to update resize job progress: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetResizeJobStatus returns the status of a job, "" when the job doesn't exist.
+// Workers poll it while they process a job, so it stays quiet on success.
+func GetResizeJobStatus(ctx context.Context, jobID string) (string, error) {
+	query := `
+    SELECT status
+    FROM tb_resize_job
+    WHERE resize_job_uuid = $1;
+    `
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return "", err
+	}
+	defer conn.Release()
+
+	var status string
+	err = conn.QueryRow(ctx, query, jobID).Scan(&status)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		logger.Log.Errorf("Failed to get resize job status: %v", err)
+		return "", err
+	}
+
+	return status, nil
+}
+
+// CancelResizeJob marks a job of ownerID as cancelled if it is still scheduled or in progress.
+// It reports whether the job was cancelled, and whether it was waiting for its time and
+// won't reach a worker. A scheduled job claimed by the scheduler is published anyway,
+// the worker skips it.
+func CancelResizeJob(ctx context.Context, jobID string, ownerID int) (bool, bool, error) {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return false, false, err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to begin transaction: %v", err)
+		return false, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the schedule keeps the scheduler from claiming the job meanwhile.
+	var waiting bool
+	err = tx.QueryRow(ctx, `
+    SELECT claimed_at IS NULL
+    FROM tb_scheduled_job
+    WHERE resize_job_uuid = $1
+    FOR UPDATE;
+    `, jobID).Scan(&waiting)
+	if err != nil && err != pgx.ErrNoRows {
+		logger.Log.Errorf("Failed to get schedule of resize job: %v", err)
+		return false, false, err
+	}
+
+	tag, err := tx.Exec(ctx, `
+    UPDATE tb_resize_job
+    SET status = 'Cancelled'
+    WHERE resize_job_uuid = $1 AND owner_id = $2 AND status IN ('Scheduled', 'In Progress');
+    `, jobID, ownerID)
+	if err != nil {
+		logger.Log.Errorf("Failed to cancel resize job: %v", err)
+		return false, false, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, false, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.Log.Errorf("Failed to commit cancelled resize job: %v", err)
+		return false, false, err
+	}
+
+	logger.Log.Infof("Successfully cancelled resize job for job ID: %s", jobID)
+	return true, waiting, nil
+}
+
 // GetResizeJobsByOwner retrieves all resize jobs for a given owner (user_id)
-func GetResizeJobsByOwner(ownerID int) ([]*model.ResizeJob, error) {
+func GetResizeJobsByOwner(ctx context.Context, ownerID int) ([]*model.ResizeJob, error) {
 	logger.Log.Infof("Getting resize jobs for owner_id: %d", ownerID)
 
-	conn, err := db.GetDB().Acquire(context.Background())
+	conn, err := db.GetDB().Acquire(ctx)
 	if err != nil {
 		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
 		return nil, err
@@ -118,12 +246,13 @@ func GetResizeJobsByOwner(ownerID int) ([]*model.ResizeJob, error) {
 
 	// Adjust the query according to your table's schema.
 	query := `
-		SELECT resize_job_uuid, status, imgs_urls, algorithm, owner_id, resize_job_id
+		SELECT resize_job_uuid, status, imgs_urls, algorithm, owner_id, resize_job_id, mode, results,
+			COALESCE(error_code, ''), COALESCE(error_message, ''), progress
 		FROM tb_resize_job
 		WHERE owner_id = $1;
 	`
 
-	rows, err := conn.Query(context.Background(), query, ownerID)
+	rows, err := conn.Query(ctx, query, ownerID)
 	if err != nil {
 		logger.Log.Errorf("Failed to query resize jobs for owner_id %d: %v", ownerID, err)
 		return nil, err
@@ -139,8 +268,12 @@ func GetResizeJobsByOwner(ownerID int) ([]*model.ResizeJob, error) {
 		var algorithm string
 		var ownerIDResult int
 		var resizeJobID int
+		var mode string
+		var results []model.ImageResult
+		var errorCode, errorMessage string
+		var progress *model.JobProgress
 
-		err = rows.Scan(&jobID, &status, &images, &algorithm, &ownerIDResult, &resizeJobID)
+		err = rows.Scan(&jobID, &status, &images, &algorithm, &ownerIDResult, &resizeJobID, &mode, &results, &errorCode, &errorMessage, &progress)
 		if err != nil {
 			logger.Log.Errorf("Error scanning row: %v", err)
 			return nil, err
@@ -153,6 +286,11 @@ func GetResizeJobsByOwner(ownerID int) ([]*model.ResizeJob, error) {
 			Algorithm: algorithm,
 			OwnerID:   ownerIDResult,
 			Id:        resizeJobID,
+			Mode:      mode,
+			Results:   results,
+			Progress:  progress,
+			ErrorCode: errorCode,
+			Error:     errorMessage,
 		}
 
 		jobs = append(jobs, job)
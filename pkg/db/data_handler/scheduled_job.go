@@ -0,0 +1,268 @@
+package data_handler
+
+import (
+	"context"
+	"time"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+
+	db "github.com/IlfGauhnith/GophicProcessor/pkg/db"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// ScheduleResizeJob records a job as scheduled and holds its queue message,
+// inputs included, until runAt.
+func ScheduleResizeJob(ctx context.Context, resizeJob model.ResizeJob, runAt time.Time) error {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to begin transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+    INSERT INTO tb_resize_job (resize_job_uuid, status, imgs_urls, algorithm, owner_id, mode, results, callback_url)
+    VALUES ($1, 'Scheduled', '{}', $2, $3, $4, '[]', NULLIF($5, ''));
+    `, resizeJob.JobID, resizeJob.Algorithm, resizeJob.OwnerID, resizeJob.Mode, resizeJob.CallbackURL)
+	if err != nil {
+		logger.Log.Errorf("Failed to save scheduled resize job: %v", err)
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+    INSERT INTO tb_scheduled_job (resize_job_uuid, owner_id, run_at, payload)
+    VALUES ($1, $2, $3, $4);
+    `, resizeJob.JobID, resizeJob.OwnerID, runAt, resizeJob)
+	if err != nil {
+		logger.Log.Errorf("Failed to schedule resize job: %v", err)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.Log.Errorf("Failed to commit scheduled resize job: %v", err)
+		return err
+	}
+
+	logger.Log.Infof("Successfully scheduled resize job %s at %s", resizeJob.JobID, runAt.Format(time.RFC3339))
+	return nil
+}
+
+// GetScheduledJobsByOwner returns the jobs of ownerID waiting for their time, soonest first.
+func GetScheduledJobsByOwner(ctx context.Context, ownerID int) ([]model.ScheduledJob, error) {
+	query := `
+    SELECT s.resize_job_uuid, s.run_at, j.mode, COALESCE(j.algorithm, ''),
+        jsonb_array_length(s.payload->'images'), s.created_at
+    FROM tb_scheduled_job s
+    JOIN tb_resize_job j ON j.resize_job_uuid = s.resize_job_uuid
+    WHERE s.owner_id = $1 AND j.status = 'Scheduled'
+    ORDER BY s.run_at;
+    `
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return nil, err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, ownerID)
+	if err != nil {
+		logger.Log.Errorf("Failed to query scheduled jobs for owner_id %d: %v", ownerID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []model.ScheduledJob{}
+	for rows.Next() {
+		var job model.ScheduledJob
+		if err := rows.Scan(&job.JobID, &job.RunAt, &job.Mode, &job.Algorithm, &job.Images, &job.CreatedAt); err != nil {
+			logger.Log.Errorf("Error scanning row: %v", err)
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Log.Errorf("Error iterating over rows: %v", err)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// RescheduleResizeJob moves a scheduled job of ownerID to runAt.
+// It reports whether the job was still waiting and got rescheduled, a job
+// claimed by the scheduler is already being published.
+func RescheduleResizeJob(ctx context.Context, jobID string, ownerID int, runAt time.Time) (bool, error) {
+	query := `
+    UPDATE tb_scheduled_job s
+    SET run_at = $3
+    FROM tb_resize_job j
+    WHERE s.resize_job_uuid = $1 AND s.owner_id = $2
+        AND s.claimed_at IS NULL
+        AND j.resize_job_uuid = s.resize_job_uuid AND j.status = 'Scheduled';
+    `
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return false, err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, query, jobID, ownerID, runAt)
+	if err != nil {
+		logger.Log.Errorf("Failed to reschedule resize job: %v", err)
+		return false, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	logger.Log.Infof("Successfully rescheduled resize job %s at %s", jobID, runAt.Format(time.RFC3339))
+	return true, nil
+}
+
+// ClaimDueScheduledJobs returns up to limit due jobs, marks them claimed and postpones
+// them by lease so that no other caller claims them while they are published. Jobs
+// cancelled while they waited are dropped, the ones cancelled once claimed are still
+// returned: the worker skips them and notifies their cancellation.
+//
+// Once published, a job is handed to the workers with RemoveScheduledJob, and one
+// failing to publish is put back with RestoreScheduledJob. A job left claimed past
+// its lease is claimed again, so it may be published twice.
+func ClaimDueScheduledJobs(ctx context.Context, limit int, lease time.Duration) ([]model.ResizeJob, error) {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return nil, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+    DELETE FROM tb_scheduled_job s
+    USING tb_resize_job j
+    WHERE j.resize_job_uuid = s.resize_job_uuid AND s.run_at <= NOW()
+        AND s.claimed_at IS NULL AND j.status <> 'Scheduled';
+    `)
+	if err != nil {
+		logger.Log.Errorf("Failed to remove cancelled scheduled jobs: %v", err)
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+    UPDATE tb_scheduled_job
+    SET run_at = NOW() + $2::bigint * INTERVAL '1 millisecond', claimed_at = NOW()
+    WHERE resize_job_uuid IN (
+        SELECT resize_job_uuid
+        FROM tb_scheduled_job
+        WHERE run_at <= NOW()
+        ORDER BY run_at
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING payload;
+    `, limit, lease.Milliseconds())
+	if err != nil {
+		logger.Log.Errorf("Failed to claim due scheduled jobs: %v", err)
+		return nil, err
+	}
+
+	var jobs []model.ResizeJob
+	for rows.Next() {
+		var job model.ResizeJob
+		if err := rows.Scan(&job); err != nil {
+			rows.Close()
+			logger.Log.Errorf("Error scanning row: %v", err)
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		logger.Log.Errorf("Error iterating over rows: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.Log.Errorf("Failed to commit claimed scheduled jobs: %v", err)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// RemoveScheduledJob marks a published job in progress, unless it was cancelled
+// meanwhile, and stops holding it.
+func RemoveScheduledJob(ctx context.Context, jobID string) error {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to begin transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+    UPDATE tb_resize_job
+    SET status = 'In Progress'
+    WHERE resize_job_uuid = $1 AND status = 'Scheduled';
+    `, jobID)
+	if err != nil {
+		logger.Log.Errorf("Failed to update status of scheduled job %s: %v", jobID, err)
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM tb_scheduled_job WHERE resize_job_uuid = $1;`, jobID)
+	if err != nil {
+		logger.Log.Errorf("Failed to remove scheduled job %s: %v", jobID, err)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RestoreScheduledJob makes a job that failed to publish due again right away.
+// It stays claimed, it is published on the next check.
+func RestoreScheduledJob(ctx context.Context, jobID string) error {
+	query := `
+    UPDATE tb_scheduled_job
+    SET run_at = NOW()
+    WHERE resize_job_uuid = $1;
+    `
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, query, jobID); err != nil {
+		logger.Log.Errorf("Failed to restore scheduled job %s: %v", jobID, err)
+		return err
+	}
+	return nil
+}
@@ -310,3 +310,81 @@ func StampNowLastLogin(userID int) error {
 	logger.Log.Infof("Successfully updated last login for user id: %d", userID)
 	return nil
 }
+
+// GetUserTier returns the subscription tier of a user.
+func GetUserTier(ctx context.Context, userID int) (string, error) {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Error acquiring connection: %v", err)
+		return "", err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	query := `
+		SELECT tier
+		FROM tb_user
+		WHERE user_id = $1`
+
+	var tier string
+	if err := conn.QueryRow(ctx, query, userID).Scan(&tier); err != nil {
+		logger.Log.Errorf("Error fetching tier of user %d: %v", userID, err)
+		return "", err
+	}
+
+	return tier, nil
+}
+
+// SetWebhookSecret replaces the webhook secret of a user.
+func SetWebhookSecret(ctx context.Context, userID int, secret string) error {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Error acquiring connection: %v", err)
+		return err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	query := `
+		UPDATE tb_user
+		SET webhook_secret = $2, updated_at = NOW()
+		WHERE user_id = $1`
+
+	cmdTag, err := conn.Exec(ctx, query, userID, secret)
+	if err != nil {
+		logger.Log.Errorf("Error setting webhook secret of user %d: %v", userID, err)
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		err = fmt.Errorf("no user found with id %d", userID)
+		logger.Log.Error(err)
+		return err
+	}
+
+	logger.Log.Infof("Successfully set webhook secret of user id: %d", userID)
+	return nil
+}
+
+// HasWebhookSecret reports whether a user has a webhook secret to sign its webhooks with.
+func HasWebhookSecret(ctx context.Context, userID int) (bool, error) {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Error acquiring connection: %v", err)
+		return false, err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	query := `
+		SELECT webhook_secret IS NOT NULL
+		FROM tb_user
+		WHERE user_id = $1`
+
+	var hasSecret bool
+	if err := conn.QueryRow(ctx, query, userID).Scan(&hasSecret); err != nil {
+		logger.Log.Errorf("Error fetching webhook secret of user %d: %v", userID, err)
+		return false, err
+	}
+
+	return hasSecret, nil
+}
@@ -0,0 +1,167 @@
+package data_handler
+
+import (
+	"context"
+	"time"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+
+	db "github.com/IlfGauhnith/GophicProcessor/pkg/db"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// SaveWebhookDelivery records a pending delivery of payload to url, due right away.
+func SaveWebhookDelivery(ctx context.Context, jobID string, ownerID int, url string, payload []byte) error {
+	query := `
+    INSERT INTO tb_webhook_delivery (resize_job_uuid, owner_id, url, payload)
+    VALUES ($1, $2, $3, $4);
+    `
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, query, jobID, ownerID, url, string(payload))
+	if err != nil {
+		logger.Log.Errorf("Failed to save webhook delivery: %v", err)
+		return err
+	}
+
+	logger.Log.Infof("Successfully saved webhook delivery for job ID: %s", jobID)
+	return nil
+}
+
+// ClaimDueWebhookDeliveries returns up to limit pending deliveries that are due, and
+// postpones them by lease so that no other caller claims them while they are sent.
+// A delivery whose outcome isn't recorded in time is claimed again. Deliveries come
+// with the webhook secret of their owner.
+func ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	query := `
+    UPDATE tb_webhook_delivery d
+    SET next_attempt_at = NOW() + $2::bigint * INTERVAL '1 millisecond'
+    FROM tb_user u
+    WHERE u.user_id = d.owner_id AND d.webhook_delivery_id IN (
+        SELECT webhook_delivery_id
+        FROM tb_webhook_delivery
+        WHERE status = 'pending' AND next_attempt_at <= NOW()
+        ORDER BY next_attempt_at
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING d.webhook_delivery_id, d.resize_job_uuid, d.owner_id, d.url, d.payload,
+        d.attempts, d.attempts_base, COALESCE(u.webhook_secret, '');
+    `
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		logger.Log.Errorf("Failed to claim webhook deliveries: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var delivery model.WebhookDelivery
+		var payload []byte
+		if err := rows.Scan(&delivery.ID, &delivery.JobID, &delivery.OwnerID, &delivery.URL, &payload, &delivery.Attempts, &delivery.AttemptsBase, &delivery.Secret); err != nil {
+			logger.Log.Errorf("Error scanning row: %v", err)
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Log.Errorf("Error iterating over rows: %v", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt saves an attempt of a delivery along with the new state of the
+// delivery: status is "pending" with the time of the next attempt, "delivered" or "failed".
+func RecordWebhookAttempt(ctx context.Context, deliveryID int, attempt model.WebhookAttempt, status string, nextAttemptAt time.Time) error {
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to begin transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+    INSERT INTO tb_webhook_attempt (webhook_delivery_id, attempt, status_code, error, duration_ms)
+    VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, ''), $5);
+    `, deliveryID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.DurationMs)
+	if err != nil {
+		logger.Log.Errorf("Failed to save webhook attempt: %v", err)
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+    UPDATE tb_webhook_delivery
+    SET status = $2, attempts = $3, next_attempt_at = $4,
+        delivered_at = CASE WHEN $5 THEN NOW() END
+    WHERE webhook_delivery_id = $1;
+    `, deliveryID, status, attempt.Attempt, nextAttemptAt, status == "delivered")
+	if err != nil {
+		logger.Log.Errorf("Failed to update webhook delivery: %v", err)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RedeliverWebhook sends the latest delivery of a job of ownerID again with a fresh
+// set of retries, whatever its state. Its attempts keep counting from the previous
+// ones. It reports whether the job has a delivery.
+func RedeliverWebhook(ctx context.Context, jobID string, ownerID int) (bool, error) {
+	query := `
+    UPDATE tb_webhook_delivery
+    SET status = 'pending', attempts_base = attempts, next_attempt_at = NOW(), delivered_at = NULL
+    WHERE webhook_delivery_id = (
+        SELECT webhook_delivery_id
+        FROM tb_webhook_delivery
+        WHERE resize_job_uuid = $1 AND owner_id = $2
+        ORDER BY webhook_delivery_id DESC
+        LIMIT 1
+    );
+    `
+	conn, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Failed to acquire DB connection: %v", err)
+		return false, err
+	}
+	logger.Log.Info("DB connection successfully acquired.")
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, query, jobID, ownerID)
+	if err != nil {
+		logger.Log.Errorf("Failed to redeliver webhook: %v", err)
+		return false, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	logger.Log.Infof("Webhook of job %s scheduled for redelivery", jobID)
+	return true, nil
+}
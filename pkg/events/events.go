@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+
+	db "github.com/IlfGauhnith/GophicProcessor/pkg/db"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// Channel is the Postgres notification channel of the job events,
+// see the trigger of migration 010.
+const Channel = "resize_job_events"
+
+const (
+	// bufferSize is the number of events a slow subscriber may lag behind
+	// before it is closed.
+	bufferSize = 32
+	// maxBackoff bounds the wait before listening again after a failure.
+	maxBackoff = 30 * time.Second
+)
+
+type subscriber struct {
+	ownerID int
+	jobID   string
+	events  chan model.JobEvent
+}
+
+var (
+	mu          sync.Mutex
+	subscribers = make(map[*subscriber]struct{})
+)
+
+// Subscribe returns the events of the jobs of ownerID, only those of jobID
+// when it isn't empty. The returned function ends the subscription.
+//
+// Events are never dropped: a subscriber too slow to keep up has its channel
+// closed instead, and must subscribe again and read the current state of the jobs.
+func Subscribe(ownerID int, jobID string) (<-chan model.JobEvent, func()) {
+	sub := &subscriber{ownerID: ownerID, jobID: jobID, events: make(chan model.JobEvent, bufferSize)}
+
+	mu.Lock()
+	subscribers[sub] = struct{}{}
+	mu.Unlock()
+
+	return sub.events, func() {
+		mu.Lock()
+		delete(subscribers, sub)
+		mu.Unlock()
+	}
+}
+
+func publish(event model.JobEvent) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for sub := range subscribers {
+		if sub.ownerID != event.OwnerID || (sub.jobID != "" && sub.jobID != event.JobID) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			logger.Log.Warnf("Closing a subscriber too slow to receive the event of job %s", event.JobID)
+			delete(subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Listen receives the job events from Postgres and dispatches them to the
+// subscribers until ctx is done. It takes a connection out of the pool for itself
+// and listens again, with a growing delay, whenever the connection fails.
+func Listen(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// A connection that worked for a while is retried right away.
+		if time.Since(start) > maxBackoff {
+			backoff = time.Second
+		}
+		logger.Log.Errorf("Listening to job events failed, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func listen(ctx context.Context) error {
+	pooled, err := db.GetDB().Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays out of the pool, it is never handed out while listening.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+	logger.Log.Infof("Listening to %s notifications", Channel)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event model.JobEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			logger.Log.Warnf("Invalid job event %q: %v", notification.Payload, err)
+			continue
+		}
+		publish(event)
+	}
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"testing"
+
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+func TestPublish(t *testing.T) {
+	jobEvents, unsubscribe := Subscribe(1, "job")
+	defer unsubscribe()
+	otherJob, unsubscribeOther := Subscribe(1, "other")
+	defer unsubscribeOther()
+	allJobs, unsubscribeAll := Subscribe(1, "")
+	defer unsubscribeAll()
+
+	publish(model.JobEvent{JobID: "job", OwnerID: 1, Status: "In Progress"})
+	publish(model.JobEvent{JobID: "job", OwnerID: 2, Status: "In Progress"})
+
+	tests := []struct {
+		name   string
+		events <-chan model.JobEvent
+		want   int
+	}{
+		{"subscriber of the job", jobEvents, 1},
+		{"subscriber of another job", otherJob, 0},
+		{"subscriber of all the jobs", allJobs, 1},
+	}
+	for _, tt := range tests {
+		if got := len(tt.events); got != tt.want {
+			t.Errorf("%s received %d events, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPublishClosesSlowSubscriber(t *testing.T) {
+	jobEvents, unsubscribe := Subscribe(1, "job")
+	defer unsubscribe()
+
+	for i := 0; i < bufferSize; i++ {
+		publish(model.JobEvent{JobID: "job", OwnerID: 1, Status: "In Progress"})
+	}
+	// The terminal event doesn't fit, the subscriber is closed rather than missing it.
+	publish(model.JobEvent{JobID: "job", OwnerID: 1, Status: "Completed"})
+
+	received := 0
+	for range jobEvents {
+		received++
+	}
+	if received != bufferSize {
+		t.Fatalf("received %d events, want %d", received, bufferSize)
+	}
+
+	// Publishing again doesn't reach the closed subscriber.
+	publish(model.JobEvent{JobID: "job", OwnerID: 1, Status: "Completed"})
+}
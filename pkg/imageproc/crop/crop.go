@@ -0,0 +1,108 @@
+package crop
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// Gravities tell which part of the image a crop keeps.
+const (
+	GravityCenter = "center"
+	GravityNorth  = "north"
+	GravitySouth  = "south"
+	GravityEast   = "east"
+	GravityWest   = "west"
+	GravitySmart  = "smart"
+)
+
+// ValidGravity reports whether gravity is a known gravity. Empty means center.
+func ValidGravity(gravity string) bool {
+	switch gravity {
+	case "", GravityCenter, GravityNorth, GravitySouth, GravityEast, GravityWest, GravitySmart:
+		return true
+	}
+	return false
+}
+
+// CoverWindow returns the largest window of img with the aspect ratio
+// width:height, positioned according to gravity. Resizing that window
+// to width x height fills the target without distorting the image.
+func CoverWindow(img image.Image, width int, height int, gravity string) (image.Rectangle, error) {
+	if width <= 0 || height <= 0 {
+		return image.Rectangle{}, fmt.Errorf("cover requires a target width and height")
+	}
+
+	bounds := img.Bounds()
+	size := image.Pt(bounds.Dx(), bounds.Dx()*height/width)
+	if size.Y > bounds.Dy() {
+		size = image.Pt(bounds.Dy()*width/height, bounds.Dy())
+	}
+	size.X = max(size.X, 1)
+	size.Y = max(size.Y, 1)
+
+	return place(img, size, gravity)
+}
+
+// CropWindow returns a window of exactly width x height pixels of img, positioned
+// according to gravity. The window is clamped to the image when it is larger.
+func CropWindow(img image.Image, width int, height int, gravity string) (image.Rectangle, error) {
+	if width <= 0 || height <= 0 {
+		return image.Rectangle{}, fmt.Errorf("crop requires a target width and height")
+	}
+
+	bounds := img.Bounds()
+	size := image.Pt(min(width, bounds.Dx()), min(height, bounds.Dy()))
+
+	return place(img, size, gravity)
+}
+
+// Crop copies the window r of img into a new image starting at the origin.
+func Crop(img image.Image, r image.Rectangle) image.Image {
+	r = r.Intersect(img.Bounds())
+	out := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(out, out.Bounds(), img, r.Min, draw.Src)
+	return out
+}
+
+// Sub returns the window r of img sharing its pixels when img supports it, and a
+// copy of them otherwise. Unlike with Crop, the window keeps its coordinates in img.
+func Sub(img image.Image, r image.Rectangle) image.Image {
+	r = r.Intersect(img.Bounds())
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+
+	out := image.NewRGBA(r)
+	draw.Draw(out, r, img, r.Min, draw.Src)
+	return out
+}
+
+// place positions a window of the given size inside img.
+func place(img image.Image, size image.Point, gravity string) (image.Rectangle, error) {
+	bounds := img.Bounds()
+	free := bounds.Size().Sub(size)
+
+	var offset image.Point
+	switch gravity {
+	case "", GravityCenter:
+		offset = image.Pt(free.X/2, free.Y/2)
+	case GravityNorth:
+		offset = image.Pt(free.X/2, 0)
+	case GravitySouth:
+		offset = image.Pt(free.X/2, free.Y)
+	case GravityWest:
+		offset = image.Pt(0, free.Y/2)
+	case GravityEast:
+		offset = image.Pt(free.X, free.Y/2)
+	case GravitySmart:
+		return SmartWindow(img, size), nil
+	default:
+		return image.Rectangle{}, fmt.Errorf("unknown gravity: %s", gravity)
+	}
+
+	origin := bounds.Min.Add(offset)
+	return image.Rectangle{Min: origin, Max: origin.Add(size)}, nil
+}
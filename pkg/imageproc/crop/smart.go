@@ -0,0 +1,222 @@
+package crop
+
+import (
+	"image"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	// analysisSize is the largest side of the reduced image windows are scored on.
+	analysisSize = 256
+	// maxCandidates is the number of positions tried along each free axis.
+	maxCandidates = 32
+	// entropyBins is the number of luma buckets used to compute entropy.
+	entropyBins = 16
+)
+
+// Weights of each feature in the score of a window.
+const (
+	edgeWeight       = 0.40
+	skinWeight       = 0.25
+	entropyWeight    = 0.20
+	saturationWeight = 0.15
+	centerWeight     = 0.05
+)
+
+// SmartWindow returns the window of the given size with the most interesting content.
+//
+// Candidate windows are scored on a reduced copy of the image by their edge energy,
+// luma entropy, share of skin-toned pixels and saturation. Every feature is normalized
+// against the best candidate so that no feature dominates because of its scale.
+// A small bias towards the center breaks ties on uniform images.
+func SmartWindow(img image.Image, size image.Point) image.Rectangle {
+	bounds := img.Bounds()
+	if size.X >= bounds.Dx() && size.Y >= bounds.Dy() {
+		return bounds
+	}
+
+	scale := math.Max(float64(max(bounds.Dx(), bounds.Dy()))/analysisSize, 1)
+	small := resize.Resize(
+		uint(math.Max(math.Round(float64(bounds.Dx())/scale), 1)),
+		uint(math.Max(math.Round(float64(bounds.Dy())/scale), 1)),
+		img, resize.Bilinear)
+	f := computeFeatures(small)
+
+	windowW := min(max(int(math.Round(float64(size.X)/scale)), 1), f.width)
+	windowH := min(max(int(math.Round(float64(size.Y)/scale)), 1), f.height)
+
+	type candidate struct {
+		x, y                            int
+		edge, skin, entropy, saturation float64
+	}
+
+	var candidates []candidate
+	var maxEdge, maxSkin, maxEntropy, maxSaturation float64
+	for _, y := range positions(f.height - windowH) {
+		for _, x := range positions(f.width - windowW) {
+			r := image.Rect(x, y, x+windowW, y+windowH)
+			c := candidate{
+				x:          x,
+				y:          y,
+				edge:       f.edge.mean(r),
+				skin:       f.skin.mean(r),
+				entropy:    f.entropy(r),
+				saturation: f.saturation.mean(r),
+			}
+			maxEdge = math.Max(maxEdge, c.edge)
+			maxSkin = math.Max(maxSkin, c.skin)
+			maxEntropy = math.Max(maxEntropy, c.entropy)
+			maxSaturation = math.Max(maxSaturation, c.saturation)
+			candidates = append(candidates, c)
+		}
+	}
+
+	best, bestScore := candidates[0], math.Inf(-1)
+	for _, c := range candidates {
+		centerX := float64(c.x) + float64(windowW)/2 - float64(f.width)/2
+		centerY := float64(c.y) + float64(windowH)/2 - float64(f.height)/2
+		offCenter := math.Hypot(centerX, centerY) / math.Hypot(float64(f.width)/2, float64(f.height)/2)
+
+		score := edgeWeight*normalize(c.edge, maxEdge) +
+			skinWeight*normalize(c.skin, maxSkin) +
+			entropyWeight*normalize(c.entropy, maxEntropy) +
+			saturationWeight*normalize(c.saturation, maxSaturation) +
+			centerWeight*(1-offCenter)
+
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+
+	// Map the window back to the full resolution image.
+	x := min(int(math.Round(float64(best.x)*scale)), bounds.Dx()-size.X)
+	y := min(int(math.Round(float64(best.y)*scale)), bounds.Dy()-size.Y)
+	origin := bounds.Min.Add(image.Pt(max(x, 0), max(y, 0)))
+	return image.Rectangle{Min: origin, Max: origin.Add(size)}.Intersect(bounds)
+}
+
+// positions returns up to maxCandidates evenly spaced offsets in [0, free],
+// always including both ends.
+func positions(free int) []int {
+	if free <= 0 {
+		return []int{0}
+	}
+
+	step := max(free/maxCandidates, 1)
+	var out []int
+	for p := 0; p < free; p += step {
+		out = append(out, p)
+	}
+	return append(out, free)
+}
+
+func normalize(value float64, maximum float64) float64 {
+	if maximum == 0 {
+		return 0
+	}
+	return value / maximum
+}
+
+// integral is a summed-area table, letting the sum of any rectangle be read in constant time.
+type integral struct {
+	width int
+	sums  []float64
+}
+
+func newIntegral(width int, height int, value func(x, y int) float64) integral {
+	t := integral{width: width + 1, sums: make([]float64, (width+1)*(height+1))}
+	for y := 0; y < height; y++ {
+		var row float64
+		for x := 0; x < width; x++ {
+			row += value(x, y)
+			t.sums[(y+1)*t.width+x+1] = t.sums[y*t.width+x+1] + row
+		}
+	}
+	return t
+}
+
+func (t integral) sum(r image.Rectangle) float64 {
+	return t.sums[r.Max.Y*t.width+r.Max.X] - t.sums[r.Min.Y*t.width+r.Max.X] -
+		t.sums[r.Max.Y*t.width+r.Min.X] + t.sums[r.Min.Y*t.width+r.Min.X]
+}
+
+func (t integral) mean(r image.Rectangle) float64 {
+	return t.sum(r) / float64(r.Dx()*r.Dy())
+}
+
+// features holds the per pixel scores of the reduced image.
+type features struct {
+	width, height int
+	edge          integral
+	skin          integral
+	saturation    integral
+	bins          [entropyBins]integral
+}
+
+// entropy returns the Shannon entropy, in bits, of the luma histogram of a window.
+func (f *features) entropy(r image.Rectangle) float64 {
+	total := float64(r.Dx() * r.Dy())
+
+	var entropy float64
+	for _, bin := range f.bins {
+		if p := bin.sum(r) / total; p > 0 {
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+func computeFeatures(img image.Image) *features {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	lumas := make([]float64, width*height)
+	skins := make([]float64, width*height)
+	saturations := make([]float64, width*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r16, g16, b16, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			r, g, b := float64(r16>>8), float64(g16>>8), float64(b16>>8)
+
+			i := y*width + x
+			lumas[i] = 0.299*r + 0.587*g + 0.114*b
+			if isSkin(r, g, b) {
+				skins[i] = 1
+			}
+			if maxC := math.Max(r, math.Max(g, b)); maxC > 0 {
+				saturations[i] = (maxC - math.Min(r, math.Min(g, b))) / maxC
+			}
+		}
+	}
+
+	luma := func(x, y int) float64 {
+		return lumas[min(max(y, 0), height-1)*width+min(max(x, 0), width-1)]
+	}
+
+	f := &features{width: width, height: height}
+	f.edge = newIntegral(width, height, func(x, y int) float64 {
+		return math.Abs(luma(x+1, y)-luma(x-1, y)) + math.Abs(luma(x, y+1)-luma(x, y-1))
+	})
+	f.skin = newIntegral(width, height, func(x, y int) float64 { return skins[y*width+x] })
+	f.saturation = newIntegral(width, height, func(x, y int) float64 { return saturations[y*width+x] })
+	for bin := range f.bins {
+		f.bins[bin] = newIntegral(width, height, func(x, y int) float64 {
+			if min(int(lumas[y*width+x])*entropyBins/256, entropyBins-1) == bin {
+				return 1
+			}
+			return 0
+		})
+	}
+
+	return f
+}
+
+// isSkin is a simple RGB skin tone classifier (Kovac et al.) for daylight pictures.
+func isSkin(r, g, b float64) bool {
+	return r > 95 && g > 40 && b > 20 &&
+		math.Max(r, math.Max(g, b))-math.Min(r, math.Min(g, b)) > 15 &&
+		math.Abs(r-g) > 15 && r > g && r > b
+}
@@ -0,0 +1,240 @@
+package metrics
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// MaxPSNR is reported instead of an infinite PSNR when both images are identical,
+// so the value can still be serialized.
+const MaxPSNR = 100.0
+
+// PSNR returns the peak signal-to-noise ratio between two images of the same size,
+// in decibels, computed over the R, G and B channels. Higher is better.
+func PSNR(reference image.Image, distorted image.Image) (float64, error) {
+	if err := sameSize(reference, distorted); err != nil {
+		return 0, err
+	}
+
+	rb := reference.Bounds()
+	db := distorted.Bounds()
+
+	var sum float64
+	for y := 0; y < rb.Dy(); y++ {
+		for x := 0; x < rb.Dx(); x++ {
+			r1, g1, b1, _ := reference.At(rb.Min.X+x, rb.Min.Y+y).RGBA()
+			r2, g2, b2, _ := distorted.At(db.Min.X+x, db.Min.Y+y).RGBA()
+
+			for _, d := range [3]float64{
+				float64(r1>>8) - float64(r2>>8),
+				float64(g1>>8) - float64(g2>>8),
+				float64(b1>>8) - float64(b2>>8),
+			} {
+				sum += d * d
+			}
+		}
+	}
+
+	mse := sum / float64(rb.Dx()*rb.Dy()*3)
+	if mse == 0 {
+		return MaxPSNR, nil
+	}
+
+	return math.Min(10*math.Log10(255*255/mse), MaxPSNR), nil
+}
+
+// SSIM returns the mean structural similarity index between the luma of two images
+// of the same size, using an 11x11 Gaussian window. 1 means identical.
+func SSIM(reference image.Image, distorted image.Image) (float64, error) {
+	if err := sameSize(reference, distorted); err != nil {
+		return 0, err
+	}
+
+	ssim, _ := ssimComponents(luma(reference), luma(distorted))
+	return ssim, nil
+}
+
+// msssimWeights are the per scale exponents from Wang, Simoncelli and Bovik (2003).
+var msssimWeights = []float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+// MSSSIM returns the multi-scale structural similarity index between two images
+// of the same size. Images too small for the five standard scales use as many
+// scales as fit, with the weights normalized accordingly.
+func MSSSIM(reference image.Image, distorted image.Image) (float64, error) {
+	if err := sameSize(reference, distorted); err != nil {
+		return 0, err
+	}
+
+	a := luma(reference)
+	b := luma(distorted)
+
+	scales := 1
+	for scales < len(msssimWeights) && min(a.width, a.height)>>scales >= windowSize {
+		scales++
+	}
+
+	weights := msssimWeights[:scales]
+	var weightSum float64
+	for _, w := range weights {
+		weightSum += w
+	}
+
+	result := 1.0
+	for i, w := range weights {
+		ssim, cs := ssimComponents(a, b)
+
+		value := cs
+		if i == scales-1 {
+			// Luminance is only compared at the coarsest scale.
+			value = ssim
+		}
+
+		result *= math.Pow(math.Max(value, 0), w/weightSum)
+
+		a = a.downsample()
+		b = b.downsample()
+	}
+
+	return result, nil
+}
+
+func sameSize(a image.Image, b image.Image) error {
+	if a.Bounds().Dx() != b.Bounds().Dx() || a.Bounds().Dy() != b.Bounds().Dy() {
+		return fmt.Errorf("images have different sizes: %v and %v", a.Bounds().Size(), b.Bounds().Size())
+	}
+	if a.Bounds().Empty() {
+		return fmt.Errorf("images are empty")
+	}
+	return nil
+}
+
+// plane is a single channel image stored row by row.
+type plane struct {
+	width  int
+	height int
+	pix    []float64
+}
+
+// luma converts an image to its BT.601 luma on a 0-255 scale.
+func luma(img image.Image) plane {
+	bounds := img.Bounds()
+	p := plane{width: bounds.Dx(), height: bounds.Dy(), pix: make([]float64, bounds.Dx()*bounds.Dy())}
+
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			p.pix[y*p.width+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+		}
+	}
+	return p
+}
+
+// downsample halves the plane averaging 2x2 blocks.
+func (p plane) downsample() plane {
+	out := plane{width: max(p.width/2, 1), height: max(p.height/2, 1)}
+	out.pix = make([]float64, out.width*out.height)
+
+	for y := 0; y < out.height; y++ {
+		for x := 0; x < out.width; x++ {
+			var sum float64
+			var n int
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					sx, sy := 2*x+dx, 2*y+dy
+					if sx < p.width && sy < p.height {
+						sum += p.pix[sy*p.width+sx]
+						n++
+					}
+				}
+			}
+			out.pix[y*out.width+x] = sum / float64(n)
+		}
+	}
+	return out
+}
+
+const windowSize = 11
+
+// gaussianKernel is the normalized 1D Gaussian window (sigma 1.5) used by SSIM.
+var gaussianKernel = func() []float64 {
+	kernel := make([]float64, windowSize)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - windowSize/2)
+		kernel[i] = math.Exp(-d * d / (2 * 1.5 * 1.5))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}()
+
+// blur filters the plane with the Gaussian window, clamping at the edges.
+func (p plane) blur() plane {
+	tmp := make([]float64, len(p.pix))
+	half := windowSize / 2
+
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			var sum float64
+			for k, w := range gaussianKernel {
+				sx := min(max(x+k-half, 0), p.width-1)
+				sum += w * p.pix[y*p.width+sx]
+			}
+			tmp[y*p.width+x] = sum
+		}
+	}
+
+	out := plane{width: p.width, height: p.height, pix: make([]float64, len(p.pix))}
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			var sum float64
+			for k, w := range gaussianKernel {
+				sy := min(max(y+k-half, 0), p.height-1)
+				sum += w * tmp[sy*p.width+x]
+			}
+			out.pix[y*p.width+x] = sum
+		}
+	}
+	return out
+}
+
+// multiply returns the pixel-wise product of two planes.
+func (p plane) multiply(other plane) plane {
+	out := plane{width: p.width, height: p.height, pix: make([]float64, len(p.pix))}
+	for i := range p.pix {
+		out.pix[i] = p.pix[i] * other.pix[i]
+	}
+	return out
+}
+
+// ssimComponents returns the mean SSIM and the mean contrast-structure term of two planes.
+func ssimComponents(a plane, b plane) (float64, float64) {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+
+	muA := a.blur()
+	muB := b.blur()
+	aa := a.multiply(a).blur()
+	bb := b.multiply(b).blur()
+	ab := a.multiply(b).blur()
+
+	var ssimSum, csSum float64
+	for i := range a.pix {
+		ma, mb := muA.pix[i], muB.pix[i]
+		varA := aa.pix[i] - ma*ma
+		varB := bb.pix[i] - mb*mb
+		covariance := ab.pix[i] - ma*mb
+
+		cs := (2*covariance + c2) / (varA + varB + c2)
+		ssimSum += (2*ma*mb + c1) / (ma*ma + mb*mb + c1) * cs
+		csSum += cs
+	}
+
+	n := float64(len(a.pix))
+	return ssimSum / n, csSum / n
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// gradient is a test image with enough detail for SSIM to have structure to compare.
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8((x ^ y) * 4), A: 255})
+		}
+	}
+	return img
+}
+
+// shifted returns img with every color channel raised by delta.
+func shifted(img *image.RGBA, delta uint8) *image.RGBA {
+	out := image.NewRGBA(img.Bounds())
+	for i, v := range img.Pix {
+		if i%4 != 3 {
+			v = uint8(min(int(v)+int(delta), 255))
+		}
+		out.Pix[i] = v
+	}
+	return out
+}
+
+// noisy returns img with every other pixel darkened by delta.
+func noisy(img *image.RGBA, delta uint8) *image.RGBA {
+	out := image.NewRGBA(img.Bounds())
+	copy(out.Pix, img.Pix)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X + y%2; x < b.Max.X; x += 2 {
+			i := out.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				out.Pix[i+c] = uint8(max(int(out.Pix[i+c])-int(delta), 0))
+			}
+		}
+	}
+	return out
+}
+
+func TestPSNR(t *testing.T) {
+	black := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	gray := shifted(black, 16)
+
+	tests := []struct {
+		name      string
+		reference image.Image
+		distorted image.Image
+		want      float64
+	}{
+		{"identical", black, black, MaxPSNR},
+		// MSE of 16², 10·log10(255²/256).
+		{"uniform error", black, gray, 10 * math.Log10(255*255/256.0)},
+		{"sub-image", gray.SubImage(image.Rect(2, 2, 6, 6)), gray.SubImage(image.Rect(0, 0, 4, 4)), MaxPSNR},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PSNR(tt.reference, tt.distorted)
+			if err != nil {
+				t.Fatalf("PSNR() error = %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("PSNR() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSIM(t *testing.T) {
+	reference := gradient(64, 64)
+
+	metrics := []struct {
+		name   string
+		metric func(image.Image, image.Image) (float64, error)
+	}{
+		{"SSIM", SSIM},
+		{"MSSSIM", MSSSIM},
+	}
+	tests := []struct {
+		name      string
+		distorted image.Image
+		min, max  float64
+	}{
+		{"identical", reference, 1 - 1e-9, 1 + 1e-9},
+		{"slightly brighter", shifted(reference, 4), 0.95, 1},
+		{"noisy", noisy(reference, 80), 0, 0.9},
+	}
+
+	for _, m := range metrics {
+		for _, tt := range tests {
+			t.Run(m.name+"/"+tt.name, func(t *testing.T) {
+				got, err := m.metric(reference, tt.distorted)
+				if err != nil {
+					t.Fatalf("%s() error = %v", m.name, err)
+				}
+				if got < tt.min || got > tt.max {
+					t.Errorf("%s() = %v, want between %v and %v", m.name, got, tt.min, tt.max)
+				}
+			})
+		}
+	}
+}
+
+func TestMetricsRejectMismatchedSizes(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b image.Image
+	}{
+		{"different sizes", gradient(8, 8), gradient(8, 9)},
+		{"empty", image.NewRGBA(image.Rectangle{}), image.NewRGBA(image.Rectangle{})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := PSNR(tt.a, tt.b); err == nil {
+				t.Error("PSNR() error = nil")
+			}
+			if _, err := SSIM(tt.a, tt.b); err == nil {
+				t.Error("SSIM() error = nil")
+			}
+			if _, err := MSSSIM(tt.a, tt.b); err == nil {
+				t.Error("MSSSIM() error = nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package palette
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+const (
+	// DefaultColors is the palette size used when none is requested.
+	DefaultColors = 5
+	// MaxColors is the largest palette that can be requested.
+	MaxColors = 16
+
+	maxIterations = 20
+	maxSamples    = 10000
+)
+
+// Extract returns the n dominant colors of an image with the share of pixels
+// each one represents, most common first.
+//
+// Colors are clustered with k-means in the CIELAB color space, where euclidean
+// distances follow perceived differences. Transparent pixels are ignored.
+// The clustering is seeded with a fixed value so the same image always yields
+// the same palette.
+func Extract(img image.Image, n int) ([]model.PaletteColor, error) {
+	if n < 1 || n > MaxColors {
+		return nil, fmt.Errorf("palette size must be between 1 and %d", MaxColors)
+	}
+
+	samples := sample(img)
+	if len(samples) == 0 {
+		return []model.PaletteColor{}, nil
+	}
+
+	centroids := initialCentroids(samples, n)
+	assignments := make([]int, len(samples))
+
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		changed := false
+		for i, s := range samples {
+			nearest := nearestCentroid(s, centroids)
+			if nearest != assignments[i] || iteration == 0 {
+				assignments[i] = nearest
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		sums := make([]lab, len(centroids))
+		counts := make([]int, len(centroids))
+		for i, s := range samples {
+			c := assignments[i]
+			sums[c] = lab{sums[c].l + s.l, sums[c].a + s.a, sums[c].b + s.b}
+			counts[c]++
+		}
+		for c := range centroids {
+			if counts[c] > 0 {
+				count := float64(counts[c])
+				centroids[c] = lab{sums[c].l / count, sums[c].a / count, sums[c].b / count}
+			}
+		}
+	}
+
+	counts := make([]int, len(centroids))
+	for _, c := range assignments {
+		counts[c]++
+	}
+
+	colors := make([]model.PaletteColor, 0, len(centroids))
+	for c, centroid := range centroids {
+		if counts[c] == 0 {
+			continue
+		}
+
+		r, g, b := centroid.toRGB()
+		colors = append(colors, model.PaletteColor{
+			Hex:        fmt.Sprintf("#%02x%02x%02x", r, g, b),
+			R:          r,
+			G:          g,
+			B:          b,
+			Proportion: float64(counts[c]) / float64(len(samples)),
+		})
+	}
+
+	sort.SliceStable(colors, func(i, j int) bool {
+		return colors[i].Proportion > colors[j].Proportion
+	})
+	return colors, nil
+}
+
+// sample converts up to maxSamples evenly spread opaque pixels to CIELAB.
+func sample(img image.Image) []lab {
+	bounds := img.Bounds()
+
+	step := 1
+	for (bounds.Dx()/step)*(bounds.Dy()/step) > maxSamples {
+		step++
+	}
+
+	var samples []lab
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			// Un-premultiply before converting.
+			samples = append(samples, rgbToLab(
+				float64(r)/float64(a),
+				float64(g)/float64(a),
+				float64(b)/float64(a),
+			))
+		}
+	}
+	return samples
+}
+
+// initialCentroids picks n starting centroids with k-means++,
+// spreading them across the samples.
+func initialCentroids(samples []lab, n int) []lab {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	centroids := []lab{samples[rng.IntN(len(samples))]}
+	distances := make([]float64, len(samples))
+
+	for len(centroids) < n {
+		var total float64
+		for i, s := range samples {
+			distances[i] = s.distance(centroids[nearestCentroid(s, centroids)])
+			total += distances[i]
+		}
+		if total == 0 {
+			// Fewer distinct colors than requested.
+			break
+		}
+
+		target := rng.Float64() * total
+		chosen := len(samples) - 1
+		for i, d := range distances {
+			target -= d
+			if target <= 0 {
+				chosen = i
+				break
+			}
+		}
+		centroids = append(centroids, samples[chosen])
+	}
+	return centroids
+}
+
+func nearestCentroid(s lab, centroids []lab) int {
+	nearest, best := 0, math.MaxFloat64
+	for i, c := range centroids {
+		if d := s.distance(c); d < best {
+			nearest, best = i, d
+		}
+	}
+	return nearest
+}
+
+// lab is a color in the CIELAB color space (D65 white point).
+type lab struct {
+	l, a, b float64
+}
+
+// distance returns the squared euclidean distance between two colors.
+func (c lab) distance(other lab) float64 {
+	dl, da, db := c.l-other.l, c.a-other.a, c.b-other.b
+	return dl*dl + da*da + db*db
+}
+
+// D65 reference white.
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+// rgbToLab converts sRGB components in the [0, 1] range to CIELAB.
+func rgbToLab(r, g, b float64) lab {
+	r, g, b = toLinear(r), toLinear(g), toLinear(b)
+
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / whiteX
+	y := (0.2126*r + 0.7152*g + 0.0722*b) / whiteY
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / whiteZ
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return lab{l: 116*fy - 16, a: 500 * (fx - fy), b: 200 * (fy - fz)}
+}
+
+// toRGB converts the color back to 8 bit sRGB components.
+func (c lab) toRGB() (uint8, uint8, uint8) {
+	fy := (c.l + 16) / 116
+	fx := fy + c.a/500
+	fz := fy - c.b/200
+
+	x := labFInverse(fx) * whiteX
+	y := labFInverse(fy) * whiteY
+	z := labFInverse(fz) * whiteZ
+
+	r := 3.2406*x - 1.5372*y - 0.4986*z
+	g := -0.9689*x + 1.8758*y + 0.0415*z
+	b := 0.0557*x - 0.2040*y + 1.0570*z
+
+	return to8Bit(r), to8Bit(g), to8Bit(b)
+}
+
+func toLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func toGamma(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func to8Bit(linear float64) uint8 {
+	v := toGamma(math.Min(math.Max(linear, 0), 1))
+	return uint8(math.Round(v * 255))
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389.0 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27.0*t + 16) / 116
+}
+
+func labFInverse(t float64) float64 {
+	if t*t*t > 216.0/24389.0 {
+		return t * t * t
+	}
+	return (116*t - 16) * 27.0 / 24389.0
+}
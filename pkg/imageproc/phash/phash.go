@@ -0,0 +1,137 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/nfnt/resize"
+)
+
+// AHash computes the average hash of an image.
+// The image is reduced to 8x8 grayscale and every bit tells
+// whether a pixel is brighter than the mean of all pixels.
+func AHash(img image.Image) uint64 {
+	pixels := grayscale(img, 8, 8)
+
+	var sum float64
+	for _, p := range pixels {
+		sum += p
+	}
+	mean := sum / float64(len(pixels))
+
+	var hash uint64
+	for i, p := range pixels {
+		if p > mean {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// DHash computes the difference hash of an image.
+// The image is reduced to 9x8 grayscale and every bit tells
+// whether a pixel is brighter than its right neighbour.
+func DHash(img image.Image) uint64 {
+	pixels := grayscale(img, 9, 8)
+
+	var hash uint64
+	bit := 0
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if pixels[y*9+x] > pixels[y*9+x+1] {
+				hash |= 1 << uint(bit)
+			}
+			bit++
+		}
+	}
+	return hash
+}
+
+// PHash computes the perceptual hash of an image.
+// The image is reduced to 32x32 grayscale and transformed with a DCT.
+// Every bit of the hash tells whether one of the 8x8 lowest frequencies
+// is above the median of those frequencies.
+func PHash(img image.Image) uint64 {
+	const size = 32
+	pixels := grayscale(img, size, size)
+	coefficients := dct2D(pixels, size)
+
+	lowFrequencies := make([]float64, 0, 64)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			lowFrequencies = append(lowFrequencies, coefficients[y*size+x])
+		}
+	}
+
+	// The DC coefficient only carries the average brightness,
+	// it is left out of the median.
+	sorted := append([]float64(nil), lowFrequencies[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, c := range lowFrequencies {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// Distance returns the Hamming distance between two hashes,
+// the number of bits that differ. Similar images have a small distance.
+func Distance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayscale reduces img to width x height and returns the luma of each pixel row by row.
+func grayscale(img image.Image, width int, height int) []float64 {
+	small := resize.Resize(uint(width), uint(height), img, resize.Bilinear)
+	bounds := small.Bounds()
+
+	pixels := make([]float64, 0, width*height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray := color.Gray16Model.Convert(small.At(x, y)).(color.Gray16)
+			pixels = append(pixels, float64(gray.Y))
+		}
+	}
+	return pixels
+}
+
+// dct2D applies a two dimensional DCT-II to a size x size matrix stored row by row.
+func dct2D(pixels []float64, size int) []float64 {
+	cosines := make([]float64, size*size)
+	for u := 0; u < size; u++ {
+		for x := 0; x < size; x++ {
+			cosines[u*size+x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / float64(2*size))
+		}
+	}
+
+	// Transform rows, then columns.
+	rows := make([]float64, size*size)
+	for y := 0; y < size; y++ {
+		for u := 0; u < size; u++ {
+			var sum float64
+			for x := 0; x < size; x++ {
+				sum += pixels[y*size+x] * cosines[u*size+x]
+			}
+			rows[y*size+u] = sum
+		}
+	}
+
+	out := make([]float64, size*size)
+	for u := 0; u < size; u++ {
+		for v := 0; v < size; v++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				sum += rows[y*size+u] * cosines[v*size+y]
+			}
+			out[v*size+u] = sum
+		}
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/nfnt/resize"
+)
+
+// pattern draws a few shapes, so that the hashes have structure to capture.
+func pattern(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / w)
+			if (x-w/3)*(x-w/3)+(y-h/2)*(y-h/2) < w*h/25 {
+				v = 255 - uint8(y*255/h)
+			}
+			if x > w*2/3 && y < h/3 {
+				v = 30
+			}
+			img.SetRGBA(x, y, color.RGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+// inverted returns img with every channel inverted.
+func inverted(img *image.RGBA) *image.RGBA {
+	out := image.NewRGBA(img.Bounds())
+	for i := range img.Pix {
+		out.Pix[i] = 255 - img.Pix[i]
+		if i%4 == 3 {
+			out.Pix[i] = img.Pix[i]
+		}
+	}
+	return out
+}
+
+// brightened returns img with every color channel raised by delta.
+func brightened(img *image.RGBA, delta uint8) *image.RGBA {
+	out := image.NewRGBA(img.Bounds())
+	for i, v := range img.Pix {
+		if i%4 != 3 && v < 255-delta {
+			v += delta
+		}
+		out.Pix[i] = v
+	}
+	return out
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b uint64
+		want int
+	}{
+		{"equal", 0xdeadbeef, 0xdeadbeef, 0},
+		{"one bit", 0, 1 << 63, 1},
+		{"some bits", 0b1011, 0b0001, 2},
+		{"all bits", 0, ^uint64(0), 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Distance(tt.a, tt.b); got != tt.want {
+				t.Errorf("Distance(%#x, %#x) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := Distance(tt.b, tt.a); got != tt.want {
+				t.Errorf("Distance(%#x, %#x) = %d, want %d", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashes(t *testing.T) {
+	original := pattern(128, 96)
+
+	hashes := []struct {
+		name string
+		hash func(image.Image) uint64
+	}{
+		{"AHash", AHash},
+		{"DHash", DHash},
+		{"PHash", PHash},
+	}
+	tests := []struct {
+		name        string
+		img         image.Image
+		maxDistance int
+		minDistance int
+	}{
+		{"same image", original, 0, 0},
+		{"upscaled", resize.Resize(256, 192, original, resize.Bilinear), 4, 0},
+		{"downscaled", resize.Resize(64, 48, original, resize.Bilinear), 4, 0},
+		{"brightened", brightened(original, 10), 4, 0},
+		{"inverted", inverted(original), 64, 32},
+	}
+
+	for _, h := range hashes {
+		for _, tt := range tests {
+			t.Run(h.name+"/"+tt.name, func(t *testing.T) {
+				d := Distance(h.hash(original), h.hash(tt.img))
+				if d > tt.maxDistance || d < tt.minDistance {
+					t.Errorf("distance = %d, want between %d and %d", d, tt.minDistance, tt.maxDistance)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package placeholder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	"github.com/nfnt/resize"
+)
+
+// LQIPSize is the largest side, in pixels, of a low quality image placeholder.
+const LQIPSize = 16
+
+// LQIP returns a tiny JPEG version of the image as a data URI,
+// small enough to be inlined in a page and stretched while the real image loads.
+func LQIP(img image.Image) (string, error) {
+	if img.Bounds().Empty() {
+		return "", fmt.Errorf("cannot compute the placeholder of an empty image")
+	}
+
+	small := resize.Thumbnail(LQIPSize, LQIPSize, img, resize.Bilinear)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, small, &jpeg.Options{Quality: 40}); err != nil {
+		return "", fmt.Errorf("failed to encode placeholder: %v", err)
+	}
+
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Components returns the BlurHash components to use for an image,
+// giving more components to its longest side.
+func Components(img image.Image) (int, int) {
+	if img.Bounds().Dy() > img.Bounds().Dx() {
+		return 3, 4
+	}
+	return 4, 3
+}
@@ -0,0 +1,350 @@
+package pngstream
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// ErrUnsupported is returned for PNG images which can't be decoded row by row,
+// interlaced ones being stored in seven passes over the whole image.
+var ErrUnsupported = errors.New("pngstream: unsupported PNG image")
+
+const signature = "\x89PNG\r\n\x1a\n"
+
+// PNG color types.
+const (
+	colorGray      = 0
+	colorRGB       = 2
+	colorPaletted  = 3
+	colorGrayAlpha = 4
+	colorRGBA      = 6
+)
+
+// Rows decodes a PNG image one row at a time, holding two rows of it at most.
+// It implements tile.Rows.
+type Rows struct {
+	width, height int
+	depth         int
+	colorType     byte
+	channels      int
+
+	// palette holds the premultiplied colors of paletted images.
+	palette [][4]float32
+	// transparent is the color stored by tRNS for gray and RGB images, one value per channel.
+	transparent []uint16
+
+	inflate io.Reader
+	bpp     int
+	cur     []byte
+	prev    []byte
+	y       int
+}
+
+// NewRows parses the header chunks of the PNG image in data and returns its rows,
+// decoded as they are read.
+func NewRows(data []byte) (*Rows, error) {
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errors.New("pngstream: not a PNG image")
+	}
+
+	r := &Rows{}
+	chunks := &chunkReader{data: data[len(signature):]}
+	seenHeader := false
+	for {
+		kind, body, err := chunks.next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case "IHDR":
+			if err := r.parseHeader(body); err != nil {
+				return nil, err
+			}
+			seenHeader = true
+		case "PLTE":
+			r.palette = make([][4]float32, len(body)/3)
+			for i := range r.palette {
+				r.palette[i] = [4]float32{float32(body[i*3]), float32(body[i*3+1]), float32(body[i*3+2]), 255}
+			}
+		case "tRNS":
+			r.parseTransparency(body)
+		case "IDAT":
+			if !seenHeader {
+				return nil, errors.New("pngstream: missing IHDR chunk")
+			}
+			if r.colorType == colorPaletted && len(r.palette) == 0 {
+				return nil, errors.New("pngstream: missing PLTE chunk")
+			}
+
+			chunks.pending = body
+			inflate, err := zlib.NewReader(&idatReader{chunks: chunks})
+			if err != nil {
+				return nil, fmt.Errorf("pngstream: %w", err)
+			}
+			r.inflate = inflate
+			return r, nil
+		case "IEND":
+			return nil, errors.New("pngstream: missing IDAT chunk")
+		}
+	}
+}
+
+func (r *Rows) parseHeader(body []byte) error {
+	if len(body) != 13 {
+		return errors.New("pngstream: bad IHDR length")
+	}
+
+	width := binary.BigEndian.Uint32(body[0:4])
+	height := binary.BigEndian.Uint32(body[4:8])
+	if width == 0 || height == 0 || width > 1<<30 || height > 1<<30 {
+		return fmt.Errorf("pngstream: bad dimensions %dx%d", width, height)
+	}
+	r.width, r.height = int(width), int(height)
+	r.depth = int(body[8])
+	r.colorType = body[9]
+	if body[12] != 0 {
+		return ErrUnsupported
+	}
+
+	switch {
+	case r.colorType == colorGray && (r.depth == 1 || r.depth == 2 || r.depth == 4 || r.depth == 8 || r.depth == 16):
+		r.channels = 1
+	case r.colorType == colorPaletted && (r.depth == 1 || r.depth == 2 || r.depth == 4 || r.depth == 8):
+		r.channels = 1
+	case r.colorType == colorRGB && (r.depth == 8 || r.depth == 16):
+		r.channels = 3
+	case r.colorType == colorGrayAlpha && (r.depth == 8 || r.depth == 16):
+		r.channels = 2
+	case r.colorType == colorRGBA && (r.depth == 8 || r.depth == 16):
+		r.channels = 4
+	default:
+		return fmt.Errorf("pngstream: bad color type %d with bit depth %d", r.colorType, r.depth)
+	}
+
+	rowBytes := (r.width*r.channels*r.depth + 7) / 8
+	r.bpp = max(1, r.channels*r.depth/8)
+	r.cur = make([]byte, 1+rowBytes)
+	r.prev = make([]byte, 1+rowBytes)
+	return nil
+}
+
+func (r *Rows) parseTransparency(body []byte) {
+	switch r.colorType {
+	case colorPaletted:
+		for i, a := range body {
+			if i >= len(r.palette) {
+				break
+			}
+			alpha := float32(a)
+			p := &r.palette[i]
+			p[0], p[1], p[2], p[3] = p[0]*alpha/255, p[1]*alpha/255, p[2]*alpha/255, alpha
+		}
+	case colorGray, colorRGB:
+		r.transparent = make([]uint16, len(body)/2)
+		for i := range r.transparent {
+			r.transparent[i] = binary.BigEndian.Uint16(body[i*2:])
+		}
+	}
+}
+
+// Size is the size of the image.
+func (r *Rows) Size() image.Point {
+	return image.Pt(r.width, r.height)
+}
+
+// Next decodes the next row into dst as premultiplied RGBA values from 0 to 255,
+// returning io.EOF past the last one.
+func (r *Rows) Next(dst []float32) error {
+	if r.y >= r.height {
+		return io.EOF
+	}
+
+	if _, err := io.ReadFull(r.inflate, r.cur); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("pngstream: row %d: %w", r.y, err)
+	}
+	if err := unfilter(r.cur[0], r.cur[1:], r.prev[1:], r.bpp); err != nil {
+		return err
+	}
+	r.convert(r.cur[1:], dst)
+
+	r.cur, r.prev = r.prev, r.cur
+	r.y++
+	return nil
+}
+
+// convert expands a row of samples to premultiplied RGBA.
+func (r *Rows) convert(row []byte, dst []float32) {
+	switch r.colorType {
+	case colorGray:
+		maxValue := float32(int(1)<<r.depth - 1)
+		for x := 0; x < r.width; x++ {
+			sample := r.sample(row, x, 0)
+			v := float32(sample) * 255 / maxValue
+			if len(r.transparent) > 0 && sample == r.transparent[0] {
+				clear(dst[x*4 : x*4+4])
+				continue
+			}
+			dst[x*4], dst[x*4+1], dst[x*4+2], dst[x*4+3] = v, v, v, 255
+		}
+	case colorPaletted:
+		for x := 0; x < r.width; x++ {
+			i := int(r.sample(row, x, 0))
+			if i < len(r.palette) {
+				copy(dst[x*4:x*4+4], r.palette[i][:])
+			} else {
+				clear(dst[x*4 : x*4+4])
+			}
+		}
+	case colorRGB:
+		maxValue := float32(int(1)<<r.depth - 1)
+		for x := 0; x < r.width; x++ {
+			red, green, blue := r.sample(row, x, 0), r.sample(row, x, 1), r.sample(row, x, 2)
+			if len(r.transparent) >= 3 && red == r.transparent[0] && green == r.transparent[1] && blue == r.transparent[2] {
+				clear(dst[x*4 : x*4+4])
+				continue
+			}
+			dst[x*4] = float32(red) * 255 / maxValue
+			dst[x*4+1] = float32(green) * 255 / maxValue
+			dst[x*4+2] = float32(blue) * 255 / maxValue
+			dst[x*4+3] = 255
+		}
+	case colorGrayAlpha:
+		maxValue := float32(int(1)<<r.depth - 1)
+		for x := 0; x < r.width; x++ {
+			a := float32(r.sample(row, x, 1)) / maxValue
+			v := float32(r.sample(row, x, 0)) * 255 / maxValue * a
+			dst[x*4], dst[x*4+1], dst[x*4+2], dst[x*4+3] = v, v, v, a*255
+		}
+	case colorRGBA:
+		maxValue := float32(int(1)<<r.depth - 1)
+		for x := 0; x < r.width; x++ {
+			a := float32(r.sample(row, x, 3)) / maxValue
+			dst[x*4] = float32(r.sample(row, x, 0)) * 255 / maxValue * a
+			dst[x*4+1] = float32(r.sample(row, x, 1)) * 255 / maxValue * a
+			dst[x*4+2] = float32(r.sample(row, x, 2)) * 255 / maxValue * a
+			dst[x*4+3] = a * 255
+		}
+	}
+}
+
+// sample returns channel c of pixel x in row.
+func (r *Rows) sample(row []byte, x int, c int) uint16 {
+	i := x*r.channels + c
+	switch r.depth {
+	case 16:
+		return binary.BigEndian.Uint16(row[i*2:])
+	case 8:
+		return uint16(row[i])
+	default:
+		bit := i * r.depth
+		shift := 8 - r.depth - bit%8
+		return uint16(row[bit/8]>>shift) & (1<<r.depth - 1)
+	}
+}
+
+// unfilter reverses the filter of a row in place, prev being the previous row
+// once unfiltered, all zeros for the first one.
+func unfilter(filter byte, cur []byte, prev []byte, bpp int) error {
+	switch filter {
+	case 0:
+	case 1:
+		for i := bpp; i < len(cur); i++ {
+			cur[i] += cur[i-bpp]
+		}
+	case 2:
+		for i := range cur {
+			cur[i] += prev[i]
+		}
+	case 3:
+		for i := range cur {
+			var left byte
+			if i >= bpp {
+				left = cur[i-bpp]
+			}
+			cur[i] += byte((int(left) + int(prev[i])) / 2)
+		}
+	case 4:
+		for i := range cur {
+			var left, upperLeft byte
+			if i >= bpp {
+				left, upperLeft = cur[i-bpp], prev[i-bpp]
+			}
+			cur[i] += paeth(left, prev[i], upperLeft)
+		}
+	default:
+		return fmt.Errorf("pngstream: bad filter type %d", filter)
+	}
+	return nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// chunkReader walks the chunks of a PNG image held in memory.
+type chunkReader struct {
+	data []byte
+	// pending is the part of the current IDAT chunk not read yet.
+	pending []byte
+}
+
+func (c *chunkReader) next() (string, []byte, error) {
+	if len(c.data) < 12 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+
+	length := binary.BigEndian.Uint32(c.data[0:4])
+	if uint64(length) > uint64(len(c.data)-12) {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	kind := string(c.data[4:8])
+	body := c.data[8 : 8+length]
+	c.data = c.data[12+length:]
+	return kind, body, nil
+}
+
+// idatReader reads the compressed image data, spread over consecutive IDAT chunks.
+type idatReader struct {
+	chunks *chunkReader
+}
+
+func (r *idatReader) Read(p []byte) (int, error) {
+	for len(r.chunks.pending) == 0 {
+		if len(r.chunks.data) < 8 || string(r.chunks.data[4:8]) != "IDAT" {
+			return 0, io.EOF
+		}
+		_, body, err := r.chunks.next()
+		if err != nil {
+			return 0, err
+		}
+		r.chunks.pending = body
+	}
+
+	n := copy(p, r.chunks.pending)
+	r.chunks.pending = r.chunks.pending[n:]
+	return n, nil
+}
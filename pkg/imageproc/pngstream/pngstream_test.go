@@ -0,0 +1,143 @@
+package pngstream
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"testing"
+
+	tile "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/tile"
+)
+
+const width, height = 37, 23
+
+func encode(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// images returns test images of every color type the png package encodes to.
+func images() map[string]image.Image {
+	gray := image.NewGray(image.Rect(0, 0, width, height))
+	gray16 := image.NewGray16(gray.Rect)
+	rgba := image.NewRGBA(gray.Rect)
+	nrgba := image.NewNRGBA(gray.Rect)
+	nrgba64 := image.NewNRGBA64(gray.Rect)
+	paletted := image.NewPaletted(gray.Rect, color.Palette{
+		color.Black, color.White, color.NRGBA{R: 255, A: 128}, color.NRGBA{G: 200, B: 100, A: 0},
+	})
+	bilevel := image.NewPaletted(gray.Rect, color.Palette{color.Black, color.White})
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			gray.SetGray(x, y, color.Gray{Y: uint8(x*7 + y)})
+			gray16.SetGray16(x, y, color.Gray16{Y: uint16(x*1777 + y*31)})
+			rgba.SetRGBA(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 11), B: uint8(x ^ y), A: 255})
+			nrgba.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 6), G: uint8(y * 11), B: 77, A: uint8(x*y + 1)})
+			nrgba64.SetNRGBA64(x, y, color.NRGBA64{R: uint16(x * 1500), G: uint16(y * 2700), B: 4000, A: uint16(x*y*60 + 100)})
+			paletted.SetColorIndex(x, y, uint8((x+y)%4))
+			bilevel.SetColorIndex(x, y, uint8((x*y)%2))
+		}
+	}
+
+	return map[string]image.Image{
+		"gray":          gray,
+		"gray16":        gray16,
+		"rgb":           rgba,
+		"rgba":          nrgba,
+		"rgba16":        nrgba64,
+		"paletted tRNS": paletted,
+		"1 bit palette": bilevel,
+	}
+}
+
+func TestRowsMatchPNGDecoder(t *testing.T) {
+	for name, img := range images() {
+		t.Run(name, func(t *testing.T) {
+			data := encode(t, img)
+			decoded, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rows, err := NewRows(data)
+			if err != nil {
+				t.Fatalf("NewRows() error = %v", err)
+			}
+			if rows.Size() != image.Pt(width, height) {
+				t.Fatalf("Size() = %v, want %dx%d", rows.Size(), width, height)
+			}
+
+			want := tile.ImageRows(decoded)
+			got := make([]float32, width*4)
+			expected := make([]float32, width*4)
+			for y := 0; y < height; y++ {
+				if err := rows.Next(got); err != nil {
+					t.Fatalf("Next() row %d error = %v", y, err)
+				}
+				want.Next(expected)
+				for i := range got {
+					if math.Abs(float64(got[i]-expected[i])) > 0.5 {
+						t.Fatalf("row %d value %d = %v, want %v", y, i, got[i], expected[i])
+					}
+				}
+			}
+			if err := rows.Next(got); err != io.EOF {
+				t.Errorf("Next() past the last row error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestNewRowsErrors(t *testing.T) {
+	data := encode(t, image.NewGray(image.Rect(0, 0, 4, 4)))
+	interlaced := bytes.Clone(data)
+	// The interlace method is the last byte of IHDR, after the signature, chunk length and type.
+	interlaced[8+8+12] = 1
+
+	tests := []struct {
+		name        string
+		data        []byte
+		unsupported bool
+	}{
+		{"not a PNG", []byte("GIF89a"), false},
+		{"truncated header", data[:20], false},
+		{"interlaced", interlaced, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRows(tt.data)
+			if err == nil {
+				t.Fatal("NewRows() error = nil")
+			}
+			if errors.Is(err, ErrUnsupported) != tt.unsupported {
+				t.Errorf("NewRows() error = %v, unsupported %v", err, tt.unsupported)
+			}
+		})
+	}
+}
+
+func TestTruncatedData(t *testing.T) {
+	data := encode(t, images()["rgb"])
+
+	for _, size := range []int{len(data) / 2, len(data) - 20} {
+		// The data is cut in the image data, or right before IEND.
+		rows, err := NewRows(data[:size])
+		row := make([]float32, width*4)
+		for y := 0; err == nil && y < height; y++ {
+			err = rows.Next(row)
+		}
+		if err == nil || err == io.EOF {
+			t.Errorf("%d bytes of %d decoded with error %v, want a decoding error", size, len(data), err)
+		}
+	}
+}
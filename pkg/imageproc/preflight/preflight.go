@@ -0,0 +1,287 @@
+package preflight
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Codes of the errors returned when an input is rejected.
+const (
+	CodeInvalidEncoding   = "invalid_encoding"
+	CodeTooManyBytes      = "too_many_bytes"
+	CodeUnsupportedFormat = "unsupported_format"
+	CodeFormatMismatch    = "format_mismatch"
+	CodeMalformed         = "malformed_image"
+	CodeTooLarge          = "dimensions_too_large"
+	CodeTooManyPixels     = "too_many_pixels"
+	CodeTooManyFrames     = "too_many_frames"
+)
+
+// Error is the rejection of an input, Code telling the reason to API clients.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("image rejected (%s): %s", e.Code, e.Message)
+}
+
+func reject(code string, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Limits bound what an input may cost to decode. MaxPixels applies to the
+// pixels of all the frames of an animation together.
+//
+// When Stream is set, the PNG and JPEG stills are bounded by the MaxStreamed
+// limits instead: the caller decodes the large ones in passes or in their compact
+// pixel format, never as a whole RGBA image. Animations and interlaced PNG images
+// keep the tight limits.
+type Limits struct {
+	MaxBytes  int
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int
+	MaxFrames int
+
+	Stream            bool
+	MaxStreamedWidth  int
+	MaxStreamedHeight int
+	MaxStreamedPixels int
+}
+
+// DefaultLimits bound an input to what a single worker can hold decoded, 256MB
+// as RGBA, next to the other jobs running on the same machine. Streamed stills
+// go up to 500 megapixels, such as 20000x20000 scans. Larger inputs need the
+// limits raised along with the memory of the workers.
+var DefaultLimits = Limits{
+	MaxBytes:  100 << 20,
+	MaxWidth:  16384,
+	MaxHeight: 16384,
+	MaxPixels: 64_000_000,
+	MaxFrames: 1000,
+
+	MaxStreamedWidth:  65535,
+	MaxStreamedHeight: 65535,
+	MaxStreamedPixels: 500_000_000,
+}
+
+// LimitsFromEnv returns the default limits overridden by IMAGE_MAX_BYTES, IMAGE_MAX_WIDTH,
+// IMAGE_MAX_HEIGHT, IMAGE_MAX_MEGAPIXELS, IMAGE_MAX_FRAMES, IMAGE_MAX_STREAMED_WIDTH,
+// IMAGE_MAX_STREAMED_HEIGHT and IMAGE_MAX_STREAMED_MEGAPIXELS.
+func LimitsFromEnv() Limits {
+	limits := DefaultLimits
+	for name, limit := range map[string]*int{
+		"IMAGE_MAX_BYTES":           &limits.MaxBytes,
+		"IMAGE_MAX_WIDTH":           &limits.MaxWidth,
+		"IMAGE_MAX_HEIGHT":          &limits.MaxHeight,
+		"IMAGE_MAX_FRAMES":          &limits.MaxFrames,
+		"IMAGE_MAX_STREAMED_WIDTH":  &limits.MaxStreamedWidth,
+		"IMAGE_MAX_STREAMED_HEIGHT": &limits.MaxStreamedHeight,
+	} {
+		if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+			*limit = value
+		}
+	}
+	for name, limit := range map[string]*int{
+		"IMAGE_MAX_MEGAPIXELS":          &limits.MaxPixels,
+		"IMAGE_MAX_STREAMED_MEGAPIXELS": &limits.MaxStreamedPixels,
+	} {
+		if value, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && value > 0 {
+			*limit = int(value * 1_000_000)
+		}
+	}
+	return limits
+}
+
+// SplitDataURI separates the media type of a "data:image/png;base64," URI from its
+// payload. Plain base64 strings are returned as is with an empty media type.
+func SplitDataURI(input string) (string, string) {
+	if !strings.HasPrefix(input, "data:") {
+		return "", input
+	}
+
+	header, payload, found := strings.Cut(input, ",")
+	if !found {
+		return "", input
+	}
+	mediaType, _, _ := strings.Cut(strings.TrimPrefix(header, "data:"), ";")
+	return mediaType, payload
+}
+
+// Decode decodes a base64 image, optionally a data URI, and checks it against limits
+// without decoding its pixels. The media type of a data URI must match the content.
+func Decode(input string, limits Limits) ([]byte, error) {
+	mediaType, payload := SplitDataURI(input)
+
+	if limits.MaxBytes > 0 && base64.StdEncoding.DecodedLen(len(payload)) > limits.MaxBytes+2 {
+		return nil, reject(CodeTooManyBytes, "the image exceeds %d bytes", limits.MaxBytes)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, reject(CodeInvalidEncoding, "invalid base64: %v", err)
+	}
+
+	if err := Check(data, mediaType, limits); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Check validates an encoded image before it is decoded. The format is detected from
+// the magic bytes, and must match claimed when given either as a media type such as
+// "image/png" or as a format name. The dimensions are read from the header only.
+func Check(data []byte, claimed string, limits Limits) error {
+	if limits.MaxBytes > 0 && len(data) > limits.MaxBytes {
+		return reject(CodeTooManyBytes, "the image exceeds %d bytes", limits.MaxBytes)
+	}
+
+	format := sniff(data)
+	if format == "" {
+		return reject(CodeUnsupportedFormat, "only jpeg, png and gif images are supported")
+	}
+
+	if claimed != "" {
+		claimedFormat := strings.TrimPrefix(strings.ToLower(claimed), "image/")
+		if claimedFormat == "jpg" || claimedFormat == "pjpeg" {
+			claimedFormat = "jpeg"
+		}
+		if claimedFormat != format {
+			return reject(CodeFormatMismatch, "the image is declared as %s but is a %s", claimed, format)
+		}
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return reject(CodeMalformed, "invalid %s header: %v", format, err)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return reject(CodeMalformed, "the image has no pixels")
+	}
+
+	maxWidth, maxHeight, maxPixels := limits.MaxWidth, limits.MaxHeight, limits.MaxPixels
+	if limits.Stream && streamable(data, format) {
+		maxWidth, maxHeight, maxPixels = limits.MaxStreamedWidth, limits.MaxStreamedHeight, limits.MaxStreamedPixels
+	}
+
+	if maxWidth > 0 && config.Width > maxWidth {
+		return reject(CodeTooLarge, "width %d exceeds the limit of %d pixels", config.Width, maxWidth)
+	}
+	if maxHeight > 0 && config.Height > maxHeight {
+		return reject(CodeTooLarge, "height %d exceeds the limit of %d pixels", config.Height, maxHeight)
+	}
+
+	frames := 1
+	if format == "gif" {
+		frames, err = countGIFFrames(data)
+		if err != nil {
+			return reject(CodeMalformed, "invalid gif: %v", err)
+		}
+		if limits.MaxFrames > 0 && frames > limits.MaxFrames {
+			return reject(CodeTooManyFrames, "%d frames exceed the limit of %d", frames, limits.MaxFrames)
+		}
+	}
+
+	if pixels := config.Width * config.Height * frames; maxPixels > 0 && pixels > maxPixels {
+		return reject(CodeTooManyPixels, "%d pixels exceed the limit of %d", pixels, maxPixels)
+	}
+
+	return nil
+}
+
+// sniff returns the format of data from its magic bytes, or "" when it isn't supported.
+func sniff(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif"
+	}
+	return ""
+}
+
+// streamable reports whether an image of format can be decoded without holding it
+// as RGBA: JPEG images, and PNG images that aren't interlaced.
+func streamable(data []byte, format string) bool {
+	switch format {
+	case "jpeg":
+		return true
+	case "png":
+		// Interlace method of the IHDR chunk, which follows the signature.
+		const interlaceOffset = 28
+		return len(data) > interlaceOffset && data[interlaceOffset] == 0
+	}
+	return false
+}
+
+// countGIFFrames walks the blocks of a GIF and counts its image descriptors
+// without decompressing any frame.
+func countGIFFrames(data []byte) (int, error) {
+	// Header and logical screen descriptor.
+	pos := 13
+	if len(data) < pos {
+		return 0, fmt.Errorf("truncated header")
+	}
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return fmt.Errorf("truncated data")
+			}
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x2C: // Image descriptor.
+			if pos+10 > len(data) {
+				return 0, fmt.Errorf("truncated image descriptor")
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			// LZW minimum code size, then the image data.
+			pos++
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x21: // Extension introducer and label.
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x3B: // Trailer.
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("unknown block 0x%02x", data[pos])
+		}
+	}
+
+	// Decoders accept a missing trailer.
+	return frames, nil
+}
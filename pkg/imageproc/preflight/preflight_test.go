@@ -0,0 +1,211 @@
+package preflight
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// interlaced marks the PNG image in data as interlaced, only its header is valid.
+func interlaced(data []byte) []byte {
+	data = append([]byte(nil), data...)
+	data[28] = 1
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+// encodeGIF encodes an animation of w x h frames. Odd frames get a palette
+// of their own, stored in a local color table.
+func encodeGIF(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+	anim := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		p := color.Palette{color.Black, color.White}
+		if i%2 == 1 {
+			p = palette.Plan9
+		}
+		frame := image.NewPaletted(image.Rect(0, 0, w, h), p)
+		frame.SetColorIndex(i%w, 0, 1)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheck(t *testing.T) {
+	limits := Limits{MaxBytes: 1 << 20, MaxWidth: 100, MaxHeight: 80, MaxPixels: 6000, MaxFrames: 4}
+	pngData := encodePNG(t, 50, 40)
+
+	streamed := limits
+	streamed.Stream = true
+	streamed.MaxStreamedWidth = 200
+	streamed.MaxStreamedHeight = 200
+	streamed.MaxStreamedPixels = 20000
+
+	tests := []struct {
+		name     string
+		data     []byte
+		claimed  string
+		limits   Limits
+		wantCode string
+	}{
+		{"png", pngData, "", limits, ""},
+		{"jpeg", encodeJPEG(t, 50, 40), "", limits, ""},
+		{"gif", encodeGIF(t, 30, 20, 4), "", limits, ""},
+		{"claimed media type", pngData, "image/png", limits, ""},
+		{"claimed jpg alias", encodeJPEG(t, 10, 10), "image/jpg", limits, ""},
+		{"claimed format name", pngData, "PNG", limits, ""},
+		{"no limits", encodePNG(t, 500, 500), "", Limits{}, ""},
+		{"too many bytes", pngData, "", Limits{MaxBytes: 10}, CodeTooManyBytes},
+		{"unsupported format", []byte("BM not a supported image"), "", limits, CodeUnsupportedFormat},
+		{"format mismatch", pngData, "image/jpeg", limits, CodeFormatMismatch},
+		{"truncated header", pngData[:20], "", limits, CodeMalformed},
+		{"too wide", encodePNG(t, 101, 10), "", limits, CodeTooLarge},
+		{"too tall", encodePNG(t, 10, 81), "", limits, CodeTooLarge},
+		{"too many pixels", encodePNG(t, 100, 61), "", limits, CodeTooManyPixels},
+		{"too many frames", encodeGIF(t, 10, 10, 5), "", limits, CodeTooManyFrames},
+		// 4 frames of 40x40 are 6400 pixels together.
+		{"too many pixels over all frames", encodeGIF(t, 40, 40, 4), "", limits, CodeTooManyPixels},
+		{"streamed png", encodePNG(t, 150, 90), "", streamed, ""},
+		{"streamed jpeg", encodeJPEG(t, 150, 90), "", streamed, ""},
+		{"streamed png too wide", encodePNG(t, 201, 10), "", streamed, CodeTooLarge},
+		{"streamed png too many pixels", encodePNG(t, 200, 101), "", streamed, CodeTooManyPixels},
+		{"interlaced png not streamed", interlaced(encodePNG(t, 100, 61)), "", streamed, CodeTooManyPixels},
+		{"gif not streamed", encodeGIF(t, 100, 61, 1), "", streamed, CodeTooManyPixels},
+		{"png without stream", encodePNG(t, 150, 90), "", limits, CodeTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.data, tt.claimed, tt.limits)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				return
+			}
+
+			var rejection *Error
+			if !errors.As(err, &rejection) {
+				t.Fatalf("Check() error = %v, want code %s", err, tt.wantCode)
+			}
+			if rejection.Code != tt.wantCode {
+				t.Errorf("Check() code = %s, want %s", rejection.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCountGIFFrames(t *testing.T) {
+	two := encodeGIF(t, 8, 8, 2)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr bool
+	}{
+		{"single frame", encodeGIF(t, 8, 8, 1), 1, false},
+		{"local color tables", encodeGIF(t, 8, 8, 7), 7, false},
+		{"missing trailer", two[:len(two)-1], 2, false},
+		{"truncated frame", two[:len(two)-10], 0, true},
+		{"truncated header", two[:12], 0, true},
+		{"unknown block", append(append([]byte(nil), two[:len(two)-1]...), 0x99), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := countGIFFrames(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("countGIFFrames() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("countGIFFrames() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data := encodePNG(t, 4, 4)
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	tests := []struct {
+		name     string
+		input    string
+		limits   Limits
+		wantCode string
+	}{
+		{"plain base64", encoded, DefaultLimits, ""},
+		{"data URI", "data:image/png;base64," + encoded, DefaultLimits, ""},
+		{"mismatched data URI", "data:image/gif;base64," + encoded, DefaultLimits, CodeFormatMismatch},
+		{"invalid base64", "not base64!", DefaultLimits, CodeInvalidEncoding},
+		{"too many bytes", encoded, Limits{MaxBytes: len(data) / 2}, CodeTooManyBytes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.input, tt.limits)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("Decode() returned %d bytes, want the %d encoded ones", len(got), len(data))
+				}
+				return
+			}
+
+			var rejection *Error
+			if !errors.As(err, &rejection) || rejection.Code != tt.wantCode {
+				t.Errorf("Decode() error = %v, want code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestLimitsFromEnv(t *testing.T) {
+	t.Setenv("IMAGE_MAX_WIDTH", "2000")
+	t.Setenv("IMAGE_MAX_MEGAPIXELS", "1.5")
+	t.Setenv("IMAGE_MAX_FRAMES", "-3")
+	t.Setenv("IMAGE_MAX_STREAMED_MEGAPIXELS", "400")
+
+	want := DefaultLimits
+	want.MaxWidth = 2000
+	want.MaxPixels = 1_500_000
+	want.MaxStreamedPixels = 400_000_000
+	if got := LimitsFromEnv(); got != want {
+		t.Errorf("LimitsFromEnv() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,219 @@
+package quantize
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Dithering methods spreading the quantization error over neighbouring pixels.
+const (
+	DitherNone           = "none"
+	DitherFloydSteinberg = "floyd-steinberg"
+	DitherAtkinson       = "atkinson"
+	DitherBayer          = "bayer"
+)
+
+// diffusion is an error diffusion kernel: each entry sends weight/divisor
+// of the error of a pixel to the pixel at dx, dy.
+type diffusion struct {
+	divisor float64
+	entries []struct{ dx, dy, weight int }
+}
+
+var floydSteinberg = diffusion{
+	divisor: 16,
+	entries: []struct{ dx, dy, weight int }{
+		{1, 0, 7}, {-1, 1, 3}, {0, 1, 5}, {1, 1, 1},
+	},
+}
+
+// atkinson only spreads 6/8 of the error, trading accuracy for contrast,
+// which suits small palettes such as e-ink displays.
+var atkinson = diffusion{
+	divisor: 8,
+	entries: []struct{ dx, dy, weight int }{
+		{1, 0, 1}, {2, 0, 1}, {-1, 1, 1}, {0, 1, 1}, {1, 1, 1}, {0, 2, 1},
+	},
+}
+
+// bayer8 is the 8x8 ordered dithering threshold matrix.
+var bayer8 = [8][8]int{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// Dither maps img to the opaque colors of palette with the given dithering method.
+// Mostly transparent pixels are left to index transparentIndex, when it is not negative.
+func Dither(img image.Image, palette color.Palette, method string, transparentIndex int) *image.Paletted {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	out := image.NewPaletted(bounds, palette)
+
+	// Opaque palette entries the pixels are matched against.
+	var candidates []int
+	for i := range palette {
+		if i != transparentIndex {
+			candidates = append(candidates, i)
+		}
+	}
+	m := newMatcher(palette, candidates)
+
+	// Un-premultiplied colors of the pixels, receiving the diffused error.
+	pixels := make([][3]float64, width*height)
+	transparent := make([]bool, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			i := y*width + x
+			if a < 0x8000 && transparentIndex >= 0 {
+				transparent[i] = true
+				continue
+			}
+			if a == 0 {
+				continue
+			}
+			pixels[i] = [3]float64{
+				float64(r*0xffff/a) / 257,
+				float64(g*0xffff/a) / 257,
+				float64(b*0xffff/a) / 257,
+			}
+		}
+	}
+
+	// Ordered dithering offsets pixels by up to the distance between palette levels.
+	spread := m.spacing()
+
+	var kernel *diffusion
+	switch method {
+	case DitherFloydSteinberg:
+		kernel = &floydSteinberg
+	case DitherAtkinson:
+		kernel = &atkinson
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			if transparent[i] {
+				out.SetColorIndex(bounds.Min.X+x, bounds.Min.Y+y, uint8(transparentIndex))
+				continue
+			}
+
+			p := pixels[i]
+			if method == DitherBayer {
+				offset := (float64(bayer8[y%8][x%8])+0.5)/64 - 0.5
+				for c := range p {
+					p[c] += offset * spread
+				}
+			}
+
+			index := m.nearest(p)
+			out.SetColorIndex(bounds.Min.X+x, bounds.Min.Y+y, uint8(index))
+
+			if kernel == nil {
+				continue
+			}
+
+			chosen := m.palette[index]
+			err := [3]float64{p[0] - float64(chosen.R), p[1] - float64(chosen.G), p[2] - float64(chosen.B)}
+			for _, e := range kernel.entries {
+				nx, ny := x+e.dx, y+e.dy
+				if nx < 0 || nx >= width || ny >= height || transparent[ny*width+nx] {
+					continue
+				}
+				n := &pixels[ny*width+nx]
+				for c := range n {
+					n[c] += err[c] * float64(e.weight) / kernel.divisor
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// matcher finds the nearest palette entry of a color, caching the answers.
+type matcher struct {
+	palette    []color.RGBA
+	candidates []int
+	cache      map[uint32]int
+}
+
+func newMatcher(palette color.Palette, candidates []int) *matcher {
+	m := &matcher{
+		palette:    make([]color.RGBA, len(palette)),
+		candidates: candidates,
+		cache:      make(map[uint32]int),
+	}
+	for i, c := range palette {
+		m.palette[i] = color.RGBAModel.Convert(c).(color.RGBA)
+	}
+	return m
+}
+
+func (m *matcher) nearest(p [3]float64) int {
+	r := clamp(p[0])
+	g := clamp(p[1])
+	b := clamp(p[2])
+	key := uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+	if index, ok := m.cache[key]; ok {
+		return index
+	}
+
+	best, bestDistance := m.candidates[0], math.MaxInt
+	for _, i := range m.candidates {
+		c := m.palette[i]
+		dr := int(r) - int(c.R)
+		dg := int(g) - int(c.G)
+		db := int(b) - int(c.B)
+		if d := dr*dr + dg*dg + db*db; d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+
+	m.cache[key] = best
+	return best
+}
+
+// spacing returns the mean distance between a palette color and its nearest neighbour,
+// measured on the channel differing the most.
+func (m *matcher) spacing() float64 {
+	if len(m.candidates) < 2 {
+		return 255
+	}
+
+	var total float64
+	for _, i := range m.candidates {
+		nearest := 255
+		for _, j := range m.candidates {
+			if i == j {
+				continue
+			}
+			a, b := m.palette[i], m.palette[j]
+			d := max(abs(int(a.R)-int(b.R)), abs(int(a.G)-int(b.G)), abs(int(a.B)-int(b.B)))
+			if d > 0 {
+				nearest = min(nearest, d)
+			}
+		}
+		total += float64(nearest)
+	}
+	return total / float64(len(m.candidates))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func clamp(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
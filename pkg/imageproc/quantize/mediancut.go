@@ -0,0 +1,127 @@
+package quantize
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// colorBox is a set of colors handled as one unit by the median cut algorithm.
+type colorBox struct {
+	colors []color.RGBA
+}
+
+// widestChannel returns the channel (0 = R, 1 = G, 2 = B) with the largest
+// range of values inside the box and the size of that range.
+func (b colorBox) widestChannel() (int, uint8) {
+	minC := [3]uint8{255, 255, 255}
+	maxC := [3]uint8{}
+	for _, c := range b.colors {
+		for i, v := range [3]uint8{c.R, c.G, c.B} {
+			minC[i] = min(minC[i], v)
+			maxC[i] = max(maxC[i], v)
+		}
+	}
+
+	channel := 0
+	for i := 1; i < 3; i++ {
+		if maxC[i]-minC[i] > maxC[channel]-minC[channel] {
+			channel = i
+		}
+	}
+	return channel, maxC[channel] - minC[channel]
+}
+
+// average returns the mean color of the box.
+func (b colorBox) average() color.RGBA {
+	var r, g, bl int
+	for _, c := range b.colors {
+		r += int(c.R)
+		g += int(c.G)
+		bl += int(c.B)
+	}
+	n := len(b.colors)
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: 255}
+}
+
+// MedianCut builds a palette of at most maxColors opaque colors
+// representing the colors found in img.
+func MedianCut(img image.Image, maxColors int) color.Palette {
+	colors := sampleColors(img)
+	if len(colors) == 0 {
+		return color.Palette{color.RGBA{A: 255}}
+	}
+
+	boxes := []colorBox{{colors: colors}}
+	for len(boxes) < maxColors {
+		// Split the box with the widest channel range.
+		target, widest := -1, uint8(0)
+		for i, box := range boxes {
+			if len(box.colors) < 2 {
+				continue
+			}
+			if _, r := box.widestChannel(); target == -1 || r > widest {
+				target, widest = i, r
+			}
+		}
+		if target == -1 || widest == 0 {
+			break
+		}
+
+		box := boxes[target]
+		channel, _ := box.widestChannel()
+		sort.Slice(box.colors, func(i, j int) bool {
+			return channelValue(box.colors[i], channel) < channelValue(box.colors[j], channel)
+		})
+
+		mid := len(box.colors) / 2
+		boxes[target] = colorBox{colors: box.colors[:mid]}
+		boxes = append(boxes, colorBox{colors: box.colors[mid:]})
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		palette = append(palette, box.average())
+	}
+	return palette
+}
+
+// sampleColors returns the opaque colors of at most ~64k pixels of img,
+// large images don't need all of them to produce a good palette.
+func sampleColors(img image.Image) []color.RGBA {
+	bounds := img.Bounds()
+
+	step := 1
+	for (bounds.Dx()/step)*(bounds.Dy()/step) > 1<<16 {
+		step++
+	}
+
+	var colors []color.RGBA
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			// Un-premultiply so partially transparent edges keep their hue.
+			colors = append(colors, color.RGBA{
+				R: uint8(r * 0xffff / a >> 8),
+				G: uint8(g * 0xffff / a >> 8),
+				B: uint8(b * 0xffff / a >> 8),
+				A: 255,
+			})
+		}
+	}
+	return colors
+}
+
+func channelValue(c color.RGBA, channel int) uint8 {
+	switch channel {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	default:
+		return c.B
+	}
+}
@@ -0,0 +1,131 @@
+package quantize
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// octreeDepth is the number of levels of the tree, one per bit of each channel.
+const octreeDepth = 8
+
+type octreeNode struct {
+	r, g, b int
+	count   int
+	// pixels is the number of colors inserted under the node.
+	pixels   int
+	leaf     bool
+	children [8]*octreeNode
+}
+
+// octree sorts colors by their bits, most significant first, in a tree of
+// up to 8 children per node. Similar colors share the deepest common node.
+type octree struct {
+	root   *octreeNode
+	leaves int
+	// levels lists the internal nodes of each depth, to reduce the deepest first.
+	levels [octreeDepth][]*octreeNode
+	sorted [octreeDepth]bool
+}
+
+func (t *octree) insert(c color.RGBA) {
+	node := t.root
+	node.pixels++
+	for depth := 0; depth < octreeDepth; depth++ {
+		shift := 7 - depth
+		index := int(c.R>>shift&1)<<2 | int(c.G>>shift&1)<<1 | int(c.B>>shift&1)
+
+		child := node.children[index]
+		if child == nil {
+			child = &octreeNode{leaf: depth == octreeDepth-1}
+			node.children[index] = child
+			if child.leaf {
+				t.leaves++
+			} else {
+				t.levels[depth+1] = append(t.levels[depth+1], child)
+			}
+		}
+		node = child
+		node.pixels++
+	}
+
+	node.r += int(c.R)
+	node.g += int(c.G)
+	node.b += int(c.B)
+	node.count++
+}
+
+// reduce merges the children of the least used node of the deepest level into it.
+func (t *octree) reduce() bool {
+	depth := octreeDepth - 1
+	for depth >= 0 && len(t.levels[depth]) == 0 {
+		depth--
+	}
+	if depth < 0 {
+		return false
+	}
+
+	// Merging nodes doesn't change the pixels of the others, each level
+	// is sorted once, the least used nodes first.
+	if !t.sorted[depth] {
+		sort.SliceStable(t.levels[depth], func(i, j int) bool {
+			return t.levels[depth][i].pixels < t.levels[depth][j].pixels
+		})
+		t.sorted[depth] = true
+	}
+	node := t.levels[depth][0]
+	t.levels[depth] = t.levels[depth][1:]
+
+	for i, child := range node.children {
+		if child == nil {
+			continue
+		}
+		node.r += child.r
+		node.g += child.g
+		node.b += child.b
+		node.count += child.count
+		node.children[i] = nil
+		t.leaves--
+	}
+	node.leaf = true
+	t.leaves++
+	return true
+}
+
+func (n *octreeNode) collect(palette color.Palette) color.Palette {
+	if n.leaf {
+		return append(palette, color.RGBA{
+			R: uint8(n.r / n.count),
+			G: uint8(n.g / n.count),
+			B: uint8(n.b / n.count),
+			A: 255,
+		})
+	}
+	for _, child := range n.children {
+		if child != nil {
+			palette = child.collect(palette)
+		}
+	}
+	return palette
+}
+
+// Octree builds a palette of at most maxColors opaque colors representing the
+// colors found in img by merging the least used branches of an octree.
+// It is faster than median cut and keeps small but distinct color areas better.
+func Octree(img image.Image, maxColors int) color.Palette {
+	colors := sampleColors(img)
+	if len(colors) == 0 {
+		return color.Palette{color.RGBA{A: 255}}
+	}
+
+	t := &octree{root: &octreeNode{}}
+	t.levels[0] = []*octreeNode{t.root}
+	for _, c := range colors {
+		t.insert(c)
+	}
+
+	for t.leaves > maxColors && t.reduce() {
+	}
+
+	return t.root.collect(nil)
+}
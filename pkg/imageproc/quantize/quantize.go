@@ -0,0 +1,180 @@
+package quantize
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// Algorithms building a palette from the colors of an image.
+const (
+	AlgorithmMedianCut = "mediancut"
+	AlgorithmOctree    = "octree"
+)
+
+const (
+	// MaxColors is the largest palette of an indexed image.
+	MaxColors = 256
+	// MinColors is the smallest palette worth generating.
+	MinColors = 2
+)
+
+// fixedPalettes are the named palettes an image can be mapped to instead of
+// a palette generated from its own colors.
+var fixedPalettes = map[string]color.Palette{
+	"bw":      {color.RGBA{A: 255}, color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+	"gray4":   grayPalette(4),
+	"gray16":  grayPalette(16),
+	"websafe": palette.WebSafe,
+	// The 7 inks of color e-paper displays.
+	"eink7": {
+		color.RGBA{A: 255},
+		color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		color.RGBA{G: 255, A: 255},
+		color.RGBA{B: 255, A: 255},
+		color.RGBA{R: 255, A: 255},
+		color.RGBA{R: 255, G: 255, A: 255},
+		color.RGBA{R: 255, G: 128, A: 255},
+	},
+}
+
+func grayPalette(levels int) color.Palette {
+	p := make(color.Palette, levels)
+	for i := range p {
+		v := uint8(i * 255 / (levels - 1))
+		p[i] = color.RGBA{R: v, G: v, B: v, A: 255}
+	}
+	return p
+}
+
+// Validate checks the quantization options of a job.
+func Validate(opts model.QuantizeOptions) error {
+	if opts.Palette != "" {
+		if _, ok := fixedPalettes[opts.Palette]; !ok {
+			return fmt.Errorf("unknown palette: %s", opts.Palette)
+		}
+	}
+	if opts.Colors != 0 && (opts.Colors < MinColors || opts.Colors > MaxColors) {
+		return fmt.Errorf("colors must be between %d and %d", MinColors, MaxColors)
+	}
+
+	switch opts.Algorithm {
+	case "", AlgorithmMedianCut, AlgorithmOctree:
+	default:
+		return fmt.Errorf("unknown quantization algorithm: %s", opts.Algorithm)
+	}
+
+	switch opts.Dither {
+	case "", DitherNone, DitherFloydSteinberg, DitherAtkinson, DitherBayer:
+	default:
+		return fmt.Errorf("unknown dithering method: %s", opts.Dither)
+	}
+	return nil
+}
+
+// Quantize converts img to an indexed image following opts, which must be valid.
+//
+// The palette is either the fixed opts.Palette or generated from the image with
+// opts.Algorithm (median cut by default) to opts.Colors colors (256 by default).
+// Images with mostly transparent pixels get a dedicated transparent palette entry.
+// Pixels are dithered with Floyd-Steinberg unless another method is given.
+func Quantize(img image.Image, opts model.QuantizeOptions) *image.Paletted {
+	p, transparentIndex := buildPalette(img, opts)
+	return Dither(img, p, ditherMethod(opts), transparentIndex)
+}
+
+// QuantizeFrames converts the frames of an animation like Quantize, to a single
+// palette generated from all of them. Colors then don't shift from one frame to
+// the next, and the parts of the frames that don't change are dithered alike.
+func QuantizeFrames(frames []image.Image, opts model.QuantizeOptions) []*image.Paletted {
+	p, transparentIndex := buildPalette(stack(frames), opts)
+	method := ditherMethod(opts)
+
+	out := make([]*image.Paletted, len(frames))
+	for i, frame := range frames {
+		out[i] = Dither(frame, p, method, transparentIndex)
+	}
+	return out
+}
+
+// buildPalette returns the palette of img following opts, and the index of its
+// transparent entry, -1 when img has no transparency.
+func buildPalette(img image.Image, opts model.QuantizeOptions) (color.Palette, int) {
+	transparency := hasTransparency(img)
+
+	var p color.Palette
+	if fixed, ok := fixedPalettes[opts.Palette]; ok {
+		p = append(color.Palette{}, fixed...)
+		if transparency && len(p) >= MaxColors {
+			// Keep room for the transparent entry.
+			p = p[:MaxColors-1]
+		}
+	} else {
+		colors := opts.Colors
+		if colors == 0 {
+			colors = MaxColors
+		}
+		if transparency && colors == MaxColors {
+			colors--
+		}
+
+		switch opts.Algorithm {
+		case AlgorithmOctree:
+			p = Octree(img, colors)
+		default:
+			p = MedianCut(img, colors)
+		}
+	}
+
+	transparentIndex := -1
+	if transparency {
+		transparentIndex = len(p)
+		p = append(p, color.RGBA{})
+	}
+	return p, transparentIndex
+}
+
+func ditherMethod(opts model.QuantizeOptions) string {
+	if opts.Dither == "" {
+		return DitherFloydSteinberg
+	}
+	return opts.Dither
+}
+
+// stacked is a set of images of the same size seen as a single one, stacked
+// from the top, to build a palette out of their colors.
+type stacked struct {
+	images []image.Image
+	height int
+}
+
+func stack(images []image.Image) *stacked {
+	return &stacked{images: images, height: images[0].Bounds().Dy()}
+}
+
+func (s *stacked) ColorModel() color.Model { return color.RGBAModel }
+
+func (s *stacked) Bounds() image.Rectangle {
+	return image.Rect(0, 0, s.images[0].Bounds().Dx(), s.height*len(s.images))
+}
+
+func (s *stacked) At(x, y int) color.Color {
+	img := s.images[y/s.height]
+	bounds := img.Bounds()
+	return img.At(bounds.Min.X+x, bounds.Min.Y+y%s.height)
+}
+
+func hasTransparency(img image.Image) bool {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a < 0x8000 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package quantize
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// fourColors is split in four quadrants of a single color each.
+func fourColors(w, h int) *image.RGBA {
+	colors := []color.RGBA{
+		{R: 200, G: 30, B: 30, A: 255},
+		{R: 30, G: 200, B: 30, A: 255},
+		{R: 30, G: 30, B: 200, A: 255},
+		{R: 240, G: 240, B: 240, A: 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, colors[2*(2*y/h)+2*x/w])
+		}
+	}
+	return img
+}
+
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// withHole makes the top left quarter of img transparent.
+func withHole(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Min.Y+b.Dy()/2; y++ {
+		for x := b.Min.X; x < b.Min.X+b.Dx()/2; x++ {
+			img.SetRGBA(x, y, color.RGBA{})
+		}
+	}
+	return img
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    model.QuantizeOptions
+		wantErr bool
+	}{
+		{"defaults", model.QuantizeOptions{}, false},
+		{"fixed palette", model.QuantizeOptions{Palette: "eink7", Dither: DitherAtkinson}, false},
+		{"generated palette", model.QuantizeOptions{Colors: 16, Algorithm: AlgorithmOctree, Dither: DitherBayer}, false},
+		{"fewest colors", model.QuantizeOptions{Colors: MinColors}, false},
+		{"most colors", model.QuantizeOptions{Colors: MaxColors}, false},
+		{"unknown palette", model.QuantizeOptions{Palette: "sepia"}, true},
+		{"too few colors", model.QuantizeOptions{Colors: 1}, true},
+		{"too many colors", model.QuantizeOptions{Colors: MaxColors + 1}, true},
+		{"unknown algorithm", model.QuantizeOptions{Algorithm: "kmeans"}, true},
+		{"unknown dithering", model.QuantizeOptions{Dither: "random"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.opts); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		opts model.QuantizeOptions
+		// maxColors bounds the palette, transparent entry included.
+		maxColors   int
+		transparent bool
+		// exact tells whether every pixel must keep its color.
+		exact bool
+	}{
+		{"default", gradient(64, 64), model.QuantizeOptions{}, MaxColors, false, false},
+		{"median cut keeps few colors", fourColors(16, 16), model.QuantizeOptions{Colors: 4, Dither: DitherNone}, 4, false, true},
+		{"octree keeps few colors", fourColors(16, 16), model.QuantizeOptions{Colors: 4, Algorithm: AlgorithmOctree, Dither: DitherNone}, 4, false, true},
+		{"median cut reduces", gradient(64, 64), model.QuantizeOptions{Colors: 8}, 8, false, false},
+		{"octree reduces", gradient(64, 64), model.QuantizeOptions{Colors: 8, Algorithm: AlgorithmOctree}, 8, false, false},
+		{"bayer", gradient(64, 64), model.QuantizeOptions{Colors: 8, Dither: DitherBayer}, 8, false, false},
+		{"fixed palette", gradient(64, 64), model.QuantizeOptions{Palette: "gray4", Dither: DitherAtkinson}, 4, false, false},
+		{"transparent entry", withHole(gradient(64, 64)), model.QuantizeOptions{Colors: 8}, 9, true, false},
+		{"transparent entry with a full palette", withHole(gradient(64, 64)), model.QuantizeOptions{}, MaxColors, true, false},
+		{"transparent entry with a fixed palette", withHole(fourColors(16, 16)), model.QuantizeOptions{Palette: "bw"}, 3, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := Quantize(tt.img, tt.opts)
+
+			if out.Bounds() != tt.img.Bounds() {
+				t.Fatalf("Quantize() bounds = %v, want %v", out.Bounds(), tt.img.Bounds())
+			}
+			if len(out.Palette) > tt.maxColors {
+				t.Errorf("Quantize() palette has %d colors, want at most %d", len(out.Palette), tt.maxColors)
+			}
+
+			transparent := false
+			b := out.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					_, _, _, srcAlpha := tt.img.At(x, y).RGBA()
+					got := color.RGBAModel.Convert(out.At(x, y)).(color.RGBA)
+					if got.A == 0 {
+						transparent = true
+						if srcAlpha != 0 {
+							t.Fatalf("pixel %d,%d became transparent", x, y)
+						}
+					}
+					if tt.exact && got != color.RGBAModel.Convert(tt.img.At(x, y)) {
+						t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, tt.img.At(x, y))
+					}
+				}
+			}
+			if transparent != tt.transparent {
+				t.Errorf("Quantize() transparent pixels = %v, want %v", transparent, tt.transparent)
+			}
+		})
+	}
+}
+
+func TestQuantizeFrames(t *testing.T) {
+	frames := []image.Image{fourColors(16, 16), gradient(16, 16), withHole(fourColors(16, 16))}
+
+	out := QuantizeFrames(frames, model.QuantizeOptions{Colors: 16})
+	if len(out) != len(frames) {
+		t.Fatalf("QuantizeFrames() returned %d frames, want %d", len(out), len(frames))
+	}
+	for i, frame := range out {
+		if frame.Bounds() != frames[i].Bounds() {
+			t.Errorf("frame %d bounds = %v, want %v", i, frame.Bounds(), frames[i].Bounds())
+		}
+		// A single palette, the transparent entry of the last frame included.
+		if len(frame.Palette) != len(out[0].Palette) || len(frame.Palette) > 17 {
+			t.Fatalf("frame %d has %d colors, frame 0 %d", i, len(frame.Palette), len(out[0].Palette))
+		}
+		for j := range frame.Palette {
+			if frame.Palette[j] != out[0].Palette[j] {
+				t.Fatalf("frame %d palette differs at %d", i, j)
+			}
+		}
+	}
+}
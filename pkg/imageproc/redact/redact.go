@@ -0,0 +1,302 @@
+package redact
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// Methods replacing the pixels of a redacted region.
+const (
+	MethodPixelate = "pixelate"
+	MethodBlur     = "blur"
+	MethodFill     = "fill"
+)
+
+const (
+	// defaultBlockSize is the side of the pixelation blocks when no strength is given.
+	defaultBlockSize = 16
+	// defaultSigma is the standard deviation of the blur when no strength is given.
+	defaultSigma = 12
+)
+
+// Validate checks the regions of a job before any image is processed.
+func Validate(regions []model.Redaction) error {
+	for i, r := range regions {
+		switch r.Method {
+		case "", MethodPixelate, MethodBlur, MethodFill:
+		default:
+			return fmt.Errorf("redaction %d: unknown method %s", i, r.Method)
+		}
+
+		hasRect := r.Width != 0 || r.Height != 0
+		switch {
+		case hasRect && len(r.Polygon) > 0:
+			return fmt.Errorf("redaction %d: a region is either a rectangle or a polygon", i)
+		case hasRect && (r.Width < 0 || r.Height < 0):
+			return fmt.Errorf("redaction %d: rectangle size must be positive", i)
+		case !hasRect && len(r.Polygon) < 3:
+			return fmt.Errorf("redaction %d: a rectangle or a polygon of at least 3 points is required", i)
+		}
+
+		if r.Relative {
+			coords := []float64{r.X, r.Y, r.X + r.Width, r.Y + r.Height}
+			for _, p := range r.Polygon {
+				coords = append(coords, p.X, p.Y)
+			}
+			for _, c := range coords {
+				if c < 0 || c > 1 {
+					return fmt.Errorf("redaction %d: relative coordinates must be between 0 and 1", i)
+				}
+			}
+		}
+
+		if r.Strength < 0 {
+			return fmt.Errorf("redaction %d: strength must not be negative", i)
+		}
+		if _, err := parseColor(r.Color); err != nil {
+			return fmt.Errorf("redaction %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Apply returns a copy of img with every region redacted. img itself is never modified.
+// Regions are expected to have been checked with Validate.
+//
+// Pixelation and blur only read the pixels of the region being redacted, so nothing
+// outside of it leaks in, and every pixel inside it is replaced.
+func Apply(img image.Image, regions []model.Redaction) image.Image {
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+
+	for _, r := range regions {
+		ApplyRegion(out, bounds, r)
+	}
+
+	return out
+}
+
+// Area returns the pixels a region covers in an image of the given bounds.
+func Area(r model.Redaction, bounds image.Rectangle) image.Rectangle {
+	area, _ := regionMask(r, bounds)
+	return area
+}
+
+// ApplyRegion redacts a single region of an image of the given bounds in place.
+// img may be a patch of that image only, as long as it holds the whole Area of the
+// region: redacting never reads outside of it.
+func ApplyRegion(img *image.RGBA, bounds image.Rectangle, r model.Redaction) {
+	area, inside := regionMask(r, bounds)
+	if area.Empty() {
+		return
+	}
+
+	switch r.Method {
+	case MethodBlur:
+		blur(img, area, inside, r.Strength)
+	case MethodFill:
+		fill, _ := parseColor(r.Color)
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				if inside(x, y) {
+					img.SetRGBA(x, y, fill)
+				}
+			}
+		}
+	default:
+		pixelate(img, area, inside, r.Strength)
+	}
+}
+
+// regionMask returns the bounding box of a region in pixel coordinates and a function
+// telling whether a pixel, tested at its center, belongs to the region.
+func regionMask(r model.Redaction, bounds image.Rectangle) (image.Rectangle, func(x, y int) bool) {
+	scaleX, scaleY := 1.0, 1.0
+	if r.Relative {
+		scaleX, scaleY = float64(bounds.Dx()), float64(bounds.Dy())
+	}
+	toImage := func(x, y float64) (float64, float64) {
+		return float64(bounds.Min.X) + x*scaleX, float64(bounds.Min.Y) + y*scaleY
+	}
+
+	if len(r.Polygon) == 0 {
+		minX, minY := toImage(r.X, r.Y)
+		maxX, maxY := toImage(r.X+r.Width, r.Y+r.Height)
+		area := image.Rect(
+			int(math.Floor(minX)), int(math.Floor(minY)),
+			int(math.Ceil(maxX)), int(math.Ceil(maxY)),
+		).Intersect(bounds)
+		return area, func(x, y int) bool { return true }
+	}
+
+	xs := make([]float64, len(r.Polygon))
+	ys := make([]float64, len(r.Polygon))
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, p := range r.Polygon {
+		xs[i], ys[i] = toImage(p.X, p.Y)
+		minX, maxX = math.Min(minX, xs[i]), math.Max(maxX, xs[i])
+		minY, maxY = math.Min(minY, ys[i]), math.Max(maxY, ys[i])
+	}
+	area := image.Rect(
+		int(math.Floor(minX)), int(math.Floor(minY)),
+		int(math.Ceil(maxX)), int(math.Ceil(maxY)),
+	).Intersect(bounds)
+
+	// Even-odd ray casting.
+	inside := func(x, y int) bool {
+		px, py := float64(x)+0.5, float64(y)+0.5
+		in := false
+		for i, j := 0, len(xs)-1; i < len(xs); j, i = i, i+1 {
+			if (ys[i] > py) != (ys[j] > py) &&
+				px < (xs[j]-xs[i])*(py-ys[i])/(ys[j]-ys[i])+xs[i] {
+				in = !in
+			}
+		}
+		return in
+	}
+	return area, inside
+}
+
+// pixelate replaces the region by blocks of the average color of the region pixels they cover.
+func pixelate(img *image.RGBA, area image.Rectangle, inside func(x, y int) bool, blockSize int) {
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+
+	for by := area.Min.Y; by < area.Max.Y; by += blockSize {
+		for bx := area.Min.X; bx < area.Max.X; bx += blockSize {
+			block := image.Rect(bx, by, bx+blockSize, by+blockSize).Intersect(area)
+
+			var sum [4]int
+			count := 0
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					if !inside(x, y) {
+						continue
+					}
+					c := img.RGBAAt(x, y)
+					sum[0] += int(c.R)
+					sum[1] += int(c.G)
+					sum[2] += int(c.B)
+					sum[3] += int(c.A)
+					count++
+				}
+			}
+			if count == 0 {
+				continue
+			}
+
+			average := color.RGBA{
+				R: uint8(sum[0] / count),
+				G: uint8(sum[1] / count),
+				B: uint8(sum[2] / count),
+				A: uint8(sum[3] / count),
+			}
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					if inside(x, y) {
+						img.SetRGBA(x, y, average)
+					}
+				}
+			}
+		}
+	}
+}
+
+// blur replaces the region by a Gaussian blur of itself. Samples falling outside
+// of the region are clamped to its bounding box and skipped when outside of the
+// polygon, so the blurred pixels only depend on the region.
+func blur(img *image.RGBA, area image.Rectangle, inside func(x, y int) bool, sigma int) {
+	if sigma <= 0 {
+		sigma = defaultSigma
+	}
+
+	radius := 3 * sigma
+	kernel := make([]float64, 2*radius+1)
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / float64(2*sigma*sigma))
+	}
+
+	width, height := area.Dx(), area.Dy()
+	// RGBA of the region pixels followed by their weight, 0 outside of the polygon.
+	values := make([][5]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if !inside(area.Min.X+x, area.Min.Y+y) {
+				continue
+			}
+			c := img.RGBAAt(area.Min.X+x, area.Min.Y+y)
+			values[y*width+x] = [5]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A), 1}
+		}
+	}
+
+	pass := func(src [][5]float64, horizontal bool) [][5]float64 {
+		dst := make([][5]float64, len(src))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				var acc [5]float64
+				for k, weight := range kernel {
+					sx, sy := x, y
+					if horizontal {
+						sx = min(max(x+k-radius, 0), width-1)
+					} else {
+						sy = min(max(y+k-radius, 0), height-1)
+					}
+					v := src[sy*width+sx]
+					for c := range acc {
+						acc[c] += weight * v[c]
+					}
+				}
+				dst[y*width+x] = acc
+			}
+		}
+		return dst
+	}
+	blurred := pass(pass(values, true), false)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if !inside(area.Min.X+x, area.Min.Y+y) {
+				continue
+			}
+			v := blurred[y*width+x]
+			if v[4] == 0 {
+				continue
+			}
+			img.SetRGBA(area.Min.X+x, area.Min.Y+y, color.RGBA{
+				R: uint8(math.Round(v[0] / v[4])),
+				G: uint8(math.Round(v[1] / v[4])),
+				B: uint8(math.Round(v[2] / v[4])),
+				A: uint8(math.Round(v[3] / v[4])),
+			})
+		}
+	}
+}
+
+// parseColor parses a "#rrggbb" fill color. Empty means black.
+func parseColor(hex string) (color.RGBA, error) {
+	if hex == "" {
+		return color.RGBA{A: 255}, nil
+	}
+
+	value := strings.TrimPrefix(hex, "#")
+	if len(value) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid fill color %s", hex)
+	}
+	rgb, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid fill color %s", hex)
+	}
+
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}, nil
+}
@@ -0,0 +1,129 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"time"
+
+	metrics "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/metrics"
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
+)
+
+// defaultCompareAlgorithms are compared when a compare job doesn't name any.
+// Seam carving doesn't scale the content, it is only compared when requested.
+var defaultCompareAlgorithms = []string{"nearest", "bilinear", "bicubic", "lanczos2", "lanczos3"}
+
+// CompareAlgorithms validates the algorithms of a compare job,
+// defaulting to every scaling algorithm.
+func CompareAlgorithms(algorithms []string) ([]string, error) {
+	if len(algorithms) == 0 {
+		return defaultCompareAlgorithms, nil
+	}
+
+	for _, algorithm := range algorithms {
+		if _, err := GetResizeStrategy(algorithm); err != nil {
+			return nil, err
+		}
+	}
+	return algorithms, nil
+}
+
+// compareAlgorithms resizes the source with each algorithm, uploads every variant
+// and measures its quality. The reference for the metrics is a round trip:
+// the encoded output is scaled back to the original size with the same algorithm
+// and compared to the original image.
+func compareAlgorithms(ctx context.Context, job model.ResizeJob, index int, src *source, algorithms []string) (model.ImageResult, error) {
+	original := src.frame()
+	originalBounds := original.Bounds()
+
+	result := model.ImageResult{Index: index}
+	previews := make([]image.Image, 0, len(algorithms))
+
+	for _, algorithm := range algorithms {
+		strategy, err := GetResizeStrategy(algorithm)
+		if err != nil {
+			return model.ImageResult{}, err
+		}
+
+		start := time.Now()
+		resized, err := strategy.Resize(ctx, original, uint(job.TargetWidth), uint(job.TargetHeight))
+		if err != nil {
+			return model.ImageResult{}, err
+		}
+		resizeTime := time.Since(start)
+
+		var buf bytes.Buffer
+		start = time.Now()
+		if err := jpeg.Encode(&buf, resized, nil); err != nil {
+			return model.ImageResult{}, fmt.Errorf("failed to encode %s variant: %v", algorithm, err)
+		}
+		encodeTime := time.Since(start)
+
+		// Measure what will actually be served, JPEG artifacts included.
+		served, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return model.ImageResult{}, fmt.Errorf("failed to decode %s variant: %v", algorithm, err)
+		}
+		roundTrip, err := strategy.Resize(ctx, served, uint(originalBounds.Dx()), uint(originalBounds.Dy()))
+		if err != nil {
+			return model.ImageResult{}, err
+		}
+
+		psnr, err := metrics.PSNR(original, roundTrip)
+		if err != nil {
+			return model.ImageResult{}, err
+		}
+		ssim, err := metrics.SSIM(original, roundTrip)
+		if err != nil {
+			return model.ImageResult{}, err
+		}
+		msssim, err := metrics.MSSSIM(original, roundTrip)
+		if err != nil {
+			return model.ImageResult{}, err
+		}
+
+		fileName := fmt.Sprintf("%s_%d_%s.jpg", job.JobID, index+1, algorithm)
+		imageURL, err := util.UploadToR2(ctx, buf.Bytes(), fileName)
+		if err != nil {
+			return model.ImageResult{}, fmt.Errorf("failed to upload %s variant: %v", algorithm, err)
+		}
+
+		bounds := resized.Bounds()
+		result.Comparisons = append(result.Comparisons, model.AlgorithmComparison{
+			Algorithm: algorithm,
+			URL:       imageURL,
+			Width:     bounds.Dx(),
+			Height:    bounds.Dy(),
+			Bytes:     buf.Len(),
+			ResizeMs:  float64(resizeTime.Microseconds()) / 1000,
+			EncodeMs:  float64(encodeTime.Microseconds()) / 1000,
+			PSNR:      psnr,
+			SSIM:      ssim,
+			MSSSIM:    msssim,
+		})
+		previews = append(previews, served)
+	}
+
+	// The job algorithm, when it is one of the compared ones,
+	// is the default output of the image.
+	preferred := result.Comparisons[0]
+	preferredImage := previews[0]
+	for i, comparison := range result.Comparisons {
+		if comparison.Algorithm == job.Algorithm {
+			preferred = comparison
+			preferredImage = previews[i]
+			break
+		}
+	}
+	result.URL = preferred.URL
+	result.Width = preferred.Width
+	result.Height = preferred.Height
+	result.Bytes = preferred.Bytes
+	addPlaceholders(&result, preferredImage)
+
+	return result, nil
+}
@@ -11,9 +11,11 @@ func GetResizeStrategy(algorithm string) (ResizeStrategy, error) {
 	case "bicubic":
 		return &BicubicStrategy{}, nil
 	case "lanczos2":
-		return &Lanczos3Strategy{}, nil
+		return &Lanczos2Strategy{}, nil
 	case "lanczos3":
 		return &Lanczos3Strategy{}, nil
+	case "seamcarve":
+		return NewSeamCarveStrategy(), nil
 	default:
 		return nil, fmt.Errorf("unknown resize algorithm: %s", algorithm)
 	}
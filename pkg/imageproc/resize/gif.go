@@ -0,0 +1,119 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+
+	quantize "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/quantize"
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// decodeAnimatedGIF returns the decoded animation when data holds a GIF
+// with more than one frame. Any other input returns nil so the caller
+// can fall back to the regular single image path.
+func decodeAnimatedGIF(data []byte) *gif.GIF {
+	if !bytes.HasPrefix(data, []byte("GIF8")) {
+		return nil
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(g.Image) < 2 {
+		return nil
+	}
+
+	return g
+}
+
+// resizeAnimatedGIF resizes every frame of an animated GIF with the given strategy
+// and re-encodes it keeping the original frame delays and loop count.
+//
+// GIF frames are usually deltas drawn on top of the previous ones, so each frame
+// is first composited on a full canvas honoring its disposal method. The resulting
+// full frames go through the transforms and are resized. Each of them is then
+// mapped to a palette of its own colors, without dithering, unless the job asks for
+// a quantization: the frames are then quantized with opts to a single palette.
+func resizeAnimatedGIF(ctx context.Context, g *gif.GIF, transforms []func(image.Image) image.Image, strategy ResizeStrategy, width uint, height uint, opts *model.QuantizeOptions) ([]byte, error) {
+	canvasBounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if canvasBounds.Empty() {
+		canvasBounds = g.Image[0].Bounds()
+	}
+
+	canvas := image.NewRGBA(canvasBounds)
+	frames := make([]*image.Paletted, 0, len(g.Image))
+	// resized holds the frames until they are all quantized together.
+	var resized []image.Image
+	disposals := make([]byte, 0, len(g.Image))
+
+	for i, frame := range g.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		// Keep a copy of the canvas to restore it after this frame
+		// when the frame asks to be disposed to the previous state.
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvasBounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		var full image.Image = canvas
+		for _, fn := range transforms {
+			full = fn(full)
+		}
+
+		scaled, err := resizeTo(ctx, strategy, full, width, height)
+		if err != nil {
+			return nil, err
+		}
+		if opts != nil {
+			// The canvas is drawn on again, a frame left at its size is copied.
+			copied := image.NewRGBA(scaled.Bounds())
+			draw.Draw(copied, copied.Bounds(), scaled, scaled.Bounds().Min, draw.Src)
+			resized = append(resized, copied)
+		} else {
+			frames = append(frames, quantize.Quantize(scaled, model.QuantizeOptions{Dither: quantize.DitherNone}))
+		}
+
+		// Every output frame is a full picture, so the canvas must be
+		// cleared before the next one is drawn.
+		disposals = append(disposals, gif.DisposalBackground)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(canvas.Pix, previous.Pix)
+		}
+	}
+
+	if opts != nil {
+		frames = quantize.QuantizeFrames(resized, *opts)
+	}
+
+	outBounds := frames[0].Bounds()
+	out := &gif.GIF{
+		Image:     frames,
+		Delay:     g.Delay,
+		Disposal:  disposals,
+		LoopCount: g.LoopCount,
+		Config: image.Config{
+			Width:  outBounds.Dx(),
+			Height: outBounds.Dy(),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, out); err != nil {
+		return nil, fmt.Errorf("failed to encode animated gif: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// animation returns a GIF of a gradient with a square moving over it.
+func animation(frames int) *gif.GIF {
+	p := color.Palette{}
+	for i := 0; i < 256; i++ {
+		p = append(p, color.RGBA{R: uint8(i), G: uint8(255 - i), B: 128, A: 255})
+	}
+
+	g := &gif.GIF{Config: image.Config{Width: 64, Height: 48}}
+	for f := 0; f < frames; f++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 64, 48), p)
+		for y := 0; y < 48; y++ {
+			for x := 0; x < 64; x++ {
+				frame.SetColorIndex(x, y, uint8(x*4))
+				if x >= f*8 && x < f*8+8 && y < 8 {
+					frame.SetColorIndex(x, y, 255)
+				}
+			}
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	return g
+}
+
+func TestResizeAnimatedGIF(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          *model.QuantizeOptions
+		sharedPalette bool
+	}{
+		{"palette of each frame", nil, false},
+		{"quantized to a single palette", &model.QuantizeOptions{Colors: 16}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := resizeAnimatedGIF(context.Background(), animation(4), nil, &BilinearStrategy{}, 32, 24, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := gif.DecodeAll(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(out.Image) != 4 {
+				t.Fatalf("got %d frames, want 4", len(out.Image))
+			}
+			if out.Config.Width != 32 || out.Config.Height != 24 {
+				t.Fatalf("got %dx%d, want 32x24", out.Config.Width, out.Config.Height)
+			}
+			for i, delay := range out.Delay {
+				if delay != 10 {
+					t.Fatalf("frame %d has delay %d, want 10", i, delay)
+				}
+			}
+
+			if tt.opts != nil && len(out.Image[0].Palette) > tt.opts.Colors {
+				t.Fatalf("got %d colors, want at most %d", len(out.Image[0].Palette), tt.opts.Colors)
+			}
+			if !tt.sharedPalette {
+				return
+			}
+			for i, frame := range out.Image[1:] {
+				if len(frame.Palette) != len(out.Image[0].Palette) {
+					t.Fatalf("frame %d has its own palette", i+1)
+				}
+				for j, c := range frame.Palette {
+					if c != out.Image[0].Palette[j] {
+						t.Fatalf("frame %d has its own palette", i+1)
+					}
+				}
+			}
+		})
+	}
+}
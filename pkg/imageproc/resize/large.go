@@ -0,0 +1,305 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	crop "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/crop"
+	pngstream "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/pngstream"
+	redact "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/redact"
+	tile "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/tile"
+	trim "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/trim"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// proxySize is the largest side of the reduced copy standing in for a large
+// source when its pixels are only analysed.
+const proxySize = 2048
+
+// largeSource is a still image above the tiling threshold, which is never held
+// decoded as a whole. Each pass over it reads its rows from the top, PNG images
+// being decoded as they are read, and the steps before the resize only narrow the
+// window to read or patch the redacted regions.
+type largeSource struct {
+	// open starts a new pass over the rows of the image.
+	open func() (tile.Rows, error)
+	size image.Point
+
+	// window is the part of the image kept by trimming and cropping.
+	window image.Rectangle
+	// patches hold the redacted regions, drawn over the rows as they are read.
+	patches []*image.RGBA
+
+	// proxy is the whole image scaled down. Hashes, palette, trim borders and smart
+	// crops are computed on it.
+	proxy *image.RGBA
+}
+
+// newLargeSource prepares the passes over the image in data and reads it once to
+// build its proxy, which also makes sure the whole image decodes.
+func newLargeSource(ctx context.Context, data []byte, format string, size image.Point) (*largeSource, error) {
+	l := &largeSource{size: size, window: image.Rectangle{Max: size}}
+
+	rows, err := pngstream.NewRows(data)
+	switch {
+	case format == "png" && err == nil:
+		if rows.Size() != size {
+			return nil, fmt.Errorf("inconsistent PNG header")
+		}
+		l.open = func() (tile.Rows, error) {
+			return pngstream.NewRows(data)
+		}
+	case format == "png" && !errors.Is(err, pngstream.ErrUnsupported):
+		return nil, err
+	default:
+		// The other formats, and interlaced PNG images, can't be decoded row by row.
+		// They are decoded once and kept in their own pixel format, which for JPEG
+		// is the compact YCbCr one, without any further full size copy.
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if img.Bounds().Size() != size {
+			return nil, fmt.Errorf("inconsistent image header")
+		}
+		l.open = func() (tile.Rows, error) {
+			return tile.ImageRows(img), nil
+		}
+	}
+
+	if err := l.buildProxy(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// rows starts a pass over the rows of window, with the redacted regions patched in.
+func (l *largeSource) rows(window image.Rectangle) (tile.Rows, error) {
+	src, err := l.open()
+	if err != nil {
+		return nil, err
+	}
+	return &windowRows{src: src, window: window, patches: l.patches, row: make([]float32, l.size.X*4)}, nil
+}
+
+func (l *largeSource) buildProxy(ctx context.Context) error {
+	scale := math.Min(float64(proxySize)/float64(max(l.size.X, l.size.Y)), 1)
+	width := max(int(math.Round(float64(l.size.X)*scale)), 1)
+	height := max(int(math.Round(float64(l.size.Y)*scale)), 1)
+
+	rows, err := l.rows(image.Rectangle{Max: l.size})
+	if err != nil {
+		return err
+	}
+	proxy, err := tile.ResizeRows(ctx, rows, width, height, tile.Kernels["bilinear"])
+	if err != nil {
+		return err
+	}
+	l.proxy = proxy
+	return nil
+}
+
+// toProxy returns the pixels of the proxy covering r, a rectangle of the image.
+func (l *largeSource) toProxy(r image.Rectangle) image.Rectangle {
+	p := l.proxy.Bounds().Size()
+	out := image.Rect(
+		r.Min.X*p.X/l.size.X, r.Min.Y*p.Y/l.size.Y,
+		ceilDiv(r.Max.X*p.X, l.size.X), ceilDiv(r.Max.Y*p.Y, l.size.Y),
+	)
+	out.Max.X, out.Max.Y = max(out.Max.X, out.Min.X+1), max(out.Max.Y, out.Min.Y+1)
+	return out.Intersect(l.proxy.Bounds())
+}
+
+// fromProxy returns the pixels of the image covered by r, a rectangle of the proxy.
+func (l *largeSource) fromProxy(r image.Rectangle) image.Rectangle {
+	p := l.proxy.Bounds().Size()
+	return image.Rect(
+		r.Min.X*l.size.X/p.X, r.Min.Y*l.size.Y/p.Y,
+		ceilDiv(r.Max.X*l.size.X, p.X), ceilDiv(r.Max.Y*l.size.Y, p.Y),
+	)
+}
+
+// frame returns the proxy of the window.
+func (l *largeSource) frame() image.Image {
+	return l.proxy.SubImage(l.toProxy(l.window))
+}
+
+// redact copies the regions out of the image in a single pass and redacts the
+// copies, which then replace the regions in every later pass. Regions are redacted
+// in order, each one seeing the previous ones redacted as with redact.Apply.
+func (l *largeSource) redact(ctx context.Context, regions []model.Redaction) error {
+	bounds := image.Rectangle{Max: l.size}
+	patches := make([]*image.RGBA, 0, len(regions))
+	last := 0
+	for _, r := range regions {
+		area := redact.Area(r, bounds)
+		patches = append(patches, image.NewRGBA(area))
+		last = max(last, area.Max.Y)
+	}
+
+	rows, err := l.rows(bounds)
+	if err != nil {
+		return err
+	}
+	row := make([]float32, l.size.X*4)
+	for y := 0; y < last; y++ {
+		if y%256 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if err := rows.Next(row); err != nil {
+			return err
+		}
+		for _, p := range patches {
+			if y < p.Rect.Min.Y || y >= p.Rect.Max.Y {
+				continue
+			}
+			pix := p.Pix[p.PixOffset(p.Rect.Min.X, y):]
+			for i, v := range row[p.Rect.Min.X*4 : p.Rect.Max.X*4] {
+				pix[i] = clampChannel(v)
+			}
+		}
+	}
+
+	for i, r := range regions {
+		for _, earlier := range patches[:i] {
+			overlap := earlier.Rect.Intersect(patches[i].Rect)
+			for y := overlap.Min.Y; y < overlap.Max.Y; y++ {
+				copy(patches[i].Pix[patches[i].PixOffset(overlap.Min.X, y):], earlier.Pix[earlier.PixOffset(overlap.Min.X, y):earlier.PixOffset(overlap.Max.X, y)])
+			}
+		}
+		redact.ApplyRegion(patches[i], bounds, r)
+	}
+
+	l.patches = patches
+	return l.buildProxy(ctx)
+}
+
+// trimWindow finds the uniform border on the proxy. The kept window is rounded
+// outwards to whole proxy pixels, and padded in image pixels.
+func (l *largeSource) trimWindow(tolerance int, padding int) image.Rectangle {
+	frame := l.frame()
+	window := trim.Window(frame, tolerance, 0)
+	if window == frame.Bounds() {
+		return l.window
+	}
+	return l.fromProxy(window).Inset(-padding).Intersect(l.window)
+}
+
+// fitWindow computes the crop window of a fit on the bounds of the window, only
+// smart crops looking at the proxy to position it.
+func (l *largeSource) fitWindow(fit string, width int, height int, gravity string) (image.Rectangle, error) {
+	// The window is first centered, smart crops are positioned afterwards.
+	placement := gravity
+	if gravity == crop.GravitySmart {
+		placement = crop.GravityCenter
+	}
+
+	var window image.Rectangle
+	var err error
+	switch fit {
+	case FitCover:
+		window, err = crop.CoverWindow(l.window, width, height, placement)
+	case FitCrop:
+		window, err = crop.CropWindow(l.window, width, height, placement)
+	default:
+		return image.Rectangle{}, fmt.Errorf("unknown fit: %s", fit)
+	}
+	if err != nil || gravity != crop.GravitySmart {
+		return window, err
+	}
+
+	size := window.Size()
+	frame := l.frame()
+	smart := crop.SmartWindow(frame, l.toProxy(image.Rectangle{Max: size}).Size())
+	origin := l.fromProxy(smart).Min
+	origin.X = min(max(origin.X, l.window.Min.X), l.window.Max.X-size.X)
+	origin.Y = min(max(origin.Y, l.window.Min.Y), l.window.Max.Y-size.Y)
+	return image.Rectangle{Min: origin, Max: origin.Add(size)}, nil
+}
+
+// resize resamples the window in strips while its rows are read. Strategies
+// without a separable kernel fall back to Lanczos3. A zero width and height keep
+// the size of the window.
+func (l *largeSource) resize(ctx context.Context, strategy ResizeStrategy, width uint, height uint) (image.Image, error) {
+	size := l.window.Size()
+	w, h := outputSize(size, width, height)
+
+	kernel, ok := stripKernel(strategy)
+	if !ok {
+		logger.Log.Warnf("%T can't resize %dx%d images, using lanczos3", strategy, size.X, size.Y)
+		kernel = tile.Kernels["lanczos3"]
+	}
+	if w == size.X && h == size.Y {
+		kernel = tile.Kernels["nearest"]
+	}
+
+	rows, err := l.rows(l.window)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log.Infof("Resizing %dx%d image in strips", size.X, size.Y)
+	return tile.ResizeRows(ctx, rows, w, h, kernel)
+}
+
+// windowRows reads the rows of a window of the image, with the patches drawn over them.
+type windowRows struct {
+	src     tile.Rows
+	window  image.Rectangle
+	patches []*image.RGBA
+	// row holds a whole row of the image, y being the index of the next one.
+	row []float32
+	y   int
+}
+
+func (w *windowRows) Size() image.Point {
+	return w.window.Size()
+}
+
+func (w *windowRows) Next(dst []float32) error {
+	for ; w.y < w.window.Min.Y; w.y++ {
+		if err := w.src.Next(w.row); err != nil {
+			return err
+		}
+	}
+	if w.y >= w.window.Max.Y {
+		return io.EOF
+	}
+
+	if err := w.src.Next(w.row); err != nil {
+		return err
+	}
+	for _, p := range w.patches {
+		if w.y < p.Rect.Min.Y || w.y >= p.Rect.Max.Y {
+			continue
+		}
+		pix := p.Pix[p.PixOffset(p.Rect.Min.X, w.y):p.PixOffset(p.Rect.Max.X, w.y)]
+		for i, v := range pix {
+			w.row[p.Rect.Min.X*4+i] = float32(v)
+		}
+	}
+	copy(dst, w.row[w.window.Min.X*4:w.window.Max.X*4])
+	w.y++
+	return nil
+}
+
+func ceilDiv(a int, b int) int {
+	return (a + b - 1) / b
+}
+
+func clampChannel(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
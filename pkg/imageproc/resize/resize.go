@@ -1,57 +1,421 @@
 package resize
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"image/jpeg"
+	"image"
+	_ "image/png"
+	"math"
+	"time"
 
 	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+	palette "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/palette"
+	phash "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/phash"
+	placeholder "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/placeholder"
+	preflight "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/preflight"
+	quantize "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/quantize"
+	redact "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/redact"
 	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
 	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
 	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
 )
 
-func ResizeImages(job model.ResizeJob) ([]string, error) {
+const (
+	// ModeResize produces one image per input at the target size.
+	ModeResize = "resize"
+	// ModeResponsive produces one image per input for each requested width.
+	ModeResponsive = "responsive"
+	// ModeCompare resizes each input with several algorithms and reports quality metrics.
+	ModeCompare = "compare"
+)
+
+// CodeInvalidJob marks jobs whose options can't be processed.
+const CodeInvalidJob = "invalid_input"
+
+// InvalidJobError is a job rejected for its options before any image was processed.
+// Its message can be shown to clients.
+type InvalidJobError struct {
+	Err error
+}
+
+func (e *InvalidJobError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidJobError) Unwrap() error {
+	return e.Err
+}
+
+// ProgressFunc receives the progress of a job before each image and once all are done.
+type ProgressFunc func(model.JobProgress)
+
+// ResizeImages processes the images of a job one after the other,
+// reporting its progress to onProgress when it isn't nil.
+//
+// Each image gets the image timeout and the whole job the job timeout, see Timeouts.
+// An image running out of time only fails that image. When the job runs out of time,
+// or ctx is cancelled, the images left are failed too and the partial results are
+// returned along with the error of the context.
+func ResizeImages(ctx context.Context, job model.ResizeJob, onProgress ProgressFunc) ([]model.ImageResult, error) {
 	logger.Log.Infof("Processing job %s with algorithm %s",
 		job.JobID, job.Algorithm)
 
-	strategy, err := GetResizeStrategy(job.Algorithm)
+	var strategy ResizeStrategy
+	var err error
+
+	// Compare jobs pick their strategies from job.Algorithms instead.
+	if job.Mode != ModeCompare {
+		strategy, err = GetResizeStrategy(job.Algorithm)
+		if err != nil {
+			logger.Log.Errorf("Invalid resize algorithm: %s", job.Algorithm)
+			return nil, &InvalidJobError{Err: err}
+		}
+	}
+
+	if seamCarve, ok := strategy.(*SeamCarveStrategy); ok {
+		if err := seamCarve.loadMasks(job.ProtectMask, job.RemoveMask); err != nil {
+			logger.Log.Errorf("Invalid seam carving masks for job %s: %v", job.JobID, err)
+			return nil, &InvalidJobError{Err: err}
+		}
+	}
+
+	var widths []int
+	var algorithms []string
+	switch job.Mode {
+	case "", ModeResize:
+	case ModeResponsive:
+		widths, err = ResponsiveWidths(job.Preset, job.Widths)
+		if err != nil {
+			logger.Log.Errorf("Invalid responsive widths for job %s: %v", job.JobID, err)
+			return nil, &InvalidJobError{Err: err}
+		}
+	case ModeCompare:
+		algorithms, err = CompareAlgorithms(job.Algorithms)
+		if err != nil {
+			logger.Log.Errorf("Invalid compare algorithms for job %s: %v", job.JobID, err)
+			return nil, &InvalidJobError{Err: err}
+		}
+	default:
+		logger.Log.Errorf("Invalid job mode: %s", job.Mode)
+		return nil, &InvalidJobError{Err: fmt.Errorf("unknown job mode: %s", job.Mode)}
+	}
+
+	if job.Quantize != nil {
+		if err := quantize.Validate(*job.Quantize); err != nil {
+			logger.Log.Errorf("Invalid quantization for job %s: %v", job.JobID, err)
+			return nil, &InvalidJobError{Err: err}
+		}
+	}
+
+	format, err := OutputFormat(job.OutputFormat, job.Quantize != nil)
 	if err != nil {
-		logger.Log.Errorf("Invalid resize algorithm: %s", job.Algorithm)
-		return nil, err
+		logger.Log.Errorf("Invalid output format for job %s: %v", job.JobID, err)
+		return nil, &InvalidJobError{Err: err}
 	}
 
-	imageURLs := make([]string, len(job.Images))
+	if err := redact.Validate(job.Redactions); err != nil {
+		logger.Log.Errorf("Invalid redactions for job %s: %v", job.JobID, err)
+		return nil, &InvalidJobError{Err: err}
+	}
+
+	if !ValidFit(job.Fit) {
+		logger.Log.Errorf("Invalid fit for job %s: %s", job.JobID, job.Fit)
+		return nil, &InvalidJobError{Err: fmt.Errorf("unknown fit: %s", job.Fit)}
+	}
+
+	paletteSize := job.PaletteSize
+	if paletteSize == 0 {
+		paletteSize = palette.DefaultColors
+	}
+
+	opts := imageOptions{
+		strategy:    strategy,
+		widths:      widths,
+		algorithms:  algorithms,
+		format:      format,
+		quantize:    job.Quantize,
+		paletteSize: paletteSize,
+		limits:      preflight.LimitsFromEnv(),
+	}
+	// Large stills are read in passes, except in compare mode which measures
+	// every variant against the decoded original.
+	opts.limits.Stream = job.Mode != ModeCompare
+
+	jobTimeout, imageTimeout := Timeouts()
+	results := make([]model.ImageResult, len(job.Images))
+
+	if jobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, jobTimeout)
+		defer cancel()
+	}
+
+	progress := model.JobProgress{Total: len(job.Images)}
+	start := time.Now()
+	report := func() {
+		if onProgress == nil {
+			return
+		}
+		progress.UpdatedAt = time.Now()
+		if progress.Processed > 0 {
+			perImage := time.Since(start).Seconds() / float64(progress.Processed)
+			eta := math.Round(perImage*float64(progress.Total-progress.Processed)*10) / 10
+			progress.ETASeconds = &eta
+		}
+		onProgress(progress)
+	}
 
 	for i, base64Str := range job.Images {
-		img, err := util.DecodeBase64Image(base64Str)
-		if err != nil {
-			logger.Log.Warnf("Failed to decode image %d: %v", i, err)
-			continue
+		if err := ctx.Err(); err != nil {
+			logger.Log.Warnf("Job %s stopped before image %d: %v", job.JobID, i+1, err)
+			for j := i; j < len(results); j++ {
+				results[j] = model.ImageResult{Index: j}
+				setContextError(&results[j], err)
+			}
+			break
 		}
 
-		width := uint(job.TargetWidth)
-		height := uint(job.TargetHeight)
+		progress.Current = i
+		report()
+
+		results[i] = processImage(ctx, imageTimeout, job, i, base64Str, opts)
+		progress.Processed++
+		if results[i].Error != "" {
+			progress.Failed++
+		}
+	}
+	report()
 
-		resizedImg := strategy.Resize(img, width, height)
+	return results, ctx.Err()
+}
+
+// imageOptions are the settings of a job shared by all its images.
+type imageOptions struct {
+	strategy    ResizeStrategy
+	widths      []int
+	algorithms  []string
+	format      string
+	quantize    *model.QuantizeOptions
+	paletteSize int
+	limits      preflight.Limits
+}
 
-		var buf bytes.Buffer
-		err = jpeg.Encode(&buf, resizedImg, nil)
+// processImage decodes, transforms, resizes and uploads the image at index i of a job
+// within timeout. Failures are reported in the returned result.
+func processImage(ctx context.Context, timeout time.Duration, job model.ResizeJob, i int, base64Str string, opts imageOptions) model.ImageResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	result := model.ImageResult{Index: i}
+
+	// Inputs are checked from their headers before any pixel is decoded.
+	data, err := preflight.Decode(base64Str, opts.limits)
+	if err != nil {
+		logger.Log.Warnf("Rejected image %d: %v", i, err)
+		result.Error = err.Error()
+		var rejection *preflight.Error
+		if errors.As(err, &rejection) {
+			result.ErrorCode = rejection.Code
+		}
+		return result
+	}
+
+	src, err := decodeSource(ctx, data, opts.limits.Stream)
+	if err != nil {
+		logger.Log.Warnf("Failed to decode image %d: %v", i, err)
+		result.Error = err.Error()
+		result.ErrorCode = preflight.CodeMalformed
+		if ctx.Err() != nil {
+			setContextError(&result, ctx.Err())
+		}
+		return result
+	}
+	src.format = opts.format
+	src.quantize = opts.quantize
+
+	// Redactions come first so that nothing computed, uploaded or
+	// stored from here on ever sees the redacted pixels.
+	if len(job.Redactions) > 0 {
+		if err := src.redact(ctx, job.Redactions); err != nil {
+			logger.Log.Warnf("Failed to redact image %d: %v", i, err)
+			result.Error = err.Error()
+			if ctx.Err() != nil {
+				setContextError(&result, ctx.Err())
+			}
+			return result
+		}
+	}
+
+	// Hashes identify the input, they are taken before any crop.
+	hashes := &model.ImageHashes{
+		AHash: phash.AHash(src.frame()),
+		DHash: phash.DHash(src.frame()),
+		PHash: phash.PHash(src.frame()),
+	}
+
+	trimBox, err := applyTrim(job, src)
+	if err != nil {
+		logger.Log.Warnf("Failed to trim image %d: %v", i, err)
+		result.Error = err.Error()
+		return result
+	}
+
+	cropBox, err := applyFit(job, src)
+	if err != nil {
+		logger.Log.Warnf("Failed to crop image %d: %v", i, err)
+		result.Error = err.Error()
+		return result
+	}
+
+	switch job.Mode {
+	case ModeResponsive:
+		result, err = resizeResponsive(ctx, job, opts.strategy, i, src, opts.widths)
+	case ModeCompare:
+		result, err = compareAlgorithms(ctx, job, i, src, opts.algorithms)
+	default:
+		result, err = resizeSingle(ctx, job, opts.strategy, i, src)
+	}
+	if err != nil {
+		logger.Log.Warnf("Failed to process image %d: %v", i, err)
+		result = model.ImageResult{Index: i, Error: err.Error()}
+		if ctx.Err() != nil {
+			setContextError(&result, ctx.Err())
+		}
+		return result
+	}
+
+	result.Hashes = hashes
+	result.Trim = trimBox
+	result.Crop = cropBox
+
+	// Resizing doesn't change the dominant colors, the input is
+	// sampled instead of each output.
+	if colors, err := palette.Extract(src.frame(), opts.paletteSize); err != nil {
+		logger.Log.Warnf("Failed to extract palette of image %d: %v", i, err)
+	} else {
+		result.Palette = colors
+	}
+
+	logger.Log.Infof("Successfully uploaded resized image %d for job %s to %s", i+1, job.JobID, result.URL)
+	return result
+}
+
+// setContextError records on result that its image was stopped by the
+// deadline or the cancellation reported by err.
+func setContextError(result *model.ImageResult, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		result.ErrorCode = CodeTimeout
+		result.Error = "the image took too long to process"
+		return
+	}
+	result.ErrorCode = CodeCancelled
+	result.Error = "the processing of the image was cancelled"
+}
+
+// resizeSingle produces one output at the job target size.
+func resizeSingle(ctx context.Context, job model.ResizeJob, strategy ResizeStrategy, index int, src *source) (model.ImageResult, error) {
+	width, height := uint(job.TargetWidth), uint(job.TargetHeight)
+	if job.Fit == FitCrop {
+		// The source was already cropped to the target size.
+		width, height = 0, 0
+	}
+
+	out, err := src.render(ctx, strategy, width, height)
+	if err != nil {
+		return model.ImageResult{}, err
+	}
+
+	fileName := fmt.Sprintf("%s_%d.%s", job.JobID, index+1, out.extension)
+	imageURL, err := util.UploadToR2(ctx, out.data, fileName)
+	if err != nil {
+		return model.ImageResult{}, fmt.Errorf("failed to upload resized image: %v", err)
+	}
+
+	result := model.ImageResult{
+		Index:  index,
+		URL:    imageURL,
+		Width:  out.width,
+		Height: out.height,
+		Bytes:  len(out.data),
+	}
+	addPlaceholders(&result, out.preview)
+
+	return result, nil
+}
+
+// resizeResponsive produces one output per requested width, keeping the aspect ratio.
+// Widths larger than the source are skipped to avoid upscaling, unless none is left,
+// in which case the source width is used.
+func resizeResponsive(ctx context.Context, job model.ResizeJob, strategy ResizeStrategy, index int, src *source, widths []int) (model.ImageResult, error) {
+	sourceWidth := src.bounds().Dx()
+
+	var targets []int
+	for _, w := range widths {
+		if w <= sourceWidth {
+			targets = append(targets, w)
+		}
+	}
+	if len(targets) == 0 {
+		targets = []int{sourceWidth}
+	}
+
+	result := model.ImageResult{Index: index}
+	urls := make([]string, 0, len(targets))
+	variantWidths := make([]int, 0, len(targets))
+
+	var largestPreview image.Image
+	for _, w := range targets {
+		out, err := src.render(ctx, strategy, uint(w), 0)
 		if err != nil {
-			logger.Log.Warnf("Failed to encode resized image %d: %v", i, err)
-			continue
+			return model.ImageResult{}, err
 		}
 
-		fileName := fmt.Sprintf("%s_%d.jpg", job.JobID, i+1)
-		imageURL, err := util.UploadToR2(buf.Bytes(), fileName)
+		fileName := fmt.Sprintf("%s_%d_%dw.%s", job.JobID, index+1, out.width, out.extension)
+		imageURL, err := util.UploadToR2(ctx, out.data, fileName)
 		if err != nil {
-			logger.Log.Warnf("Failed to upload resized image %d to S3: %v", i, err)
-			continue
+			return model.ImageResult{}, fmt.Errorf("failed to upload %dw variant: %v", w, err)
 		}
 
-		imageURLs[i] = imageURL
-		logger.Log.Infof("Successfully uploaded resized image %d for job %s to %s", i+1, job.JobID, imageURL)
+		result.Variants = append(result.Variants, model.ImageVariant{
+			Width:  out.width,
+			Height: out.height,
+			Bytes:  len(out.data),
+			URL:    imageURL,
+		})
+		urls = append(urls, imageURL)
+		variantWidths = append(variantWidths, out.width)
+		largestPreview = out.preview
 	}
 
-	return imageURLs, nil
+	// The largest variant is the default image of the set.
+	largest := result.Variants[len(result.Variants)-1]
+	result.URL = largest.URL
+	result.Width = largest.Width
+	result.Height = largest.Height
+	result.Bytes = largest.Bytes
+	result.Srcset = srcset(urls, variantWidths)
+	addPlaceholders(&result, largestPreview)
+
+	return result, nil
+}
+
+// addPlaceholders fills the BlurHash and LQIP of a result from its output image.
+// Placeholders are optional, failures are only logged.
+func addPlaceholders(result *model.ImageResult, img image.Image) {
+	xComponents, yComponents := placeholder.Components(img)
+	if hash, err := placeholder.BlurHash(img, xComponents, yComponents); err != nil {
+		logger.Log.Warnf("Failed to compute blurhash of image %d: %v", result.Index, err)
+	} else {
+		result.BlurHash = hash
+	}
+
+	if lqip, err := placeholder.LQIP(img); err != nil {
+		logger.Log.Warnf("Failed to compute placeholder of image %d: %v", result.Index, err)
+	} else {
+		result.LQIP = lqip
+	}
 }
@@ -0,0 +1,72 @@
+package resize
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	preflight "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/preflight"
+)
+
+// maxResponsiveWidths bounds the number of variants of a responsive job, each one
+// being a resize and an upload per image.
+const maxResponsiveWidths = 16
+
+// maxResponsiveWidth bounds each variant to the widest input accepted by default.
+var maxResponsiveWidth = preflight.DefaultLimits.MaxWidth
+
+// responsivePresets are named width lists that can be requested
+// instead of passing the widths explicitly.
+var responsivePresets = map[string][]int{
+	"web-responsive": {320, 640, 960, 1280, 1920},
+	"thumbnails":     {64, 128, 256},
+}
+
+// ResponsiveWidths resolves the widths of a responsive job.
+// Explicit widths take precedence over the preset.
+// The result is sorted in ascending order without duplicates. At most
+// maxResponsiveWidths widths up to maxResponsiveWidth are accepted.
+func ResponsiveWidths(preset string, widths []int) ([]int, error) {
+	if len(widths) == 0 {
+		if preset == "" {
+			return nil, fmt.Errorf("responsive jobs require widths or a preset")
+		}
+
+		presetWidths, ok := responsivePresets[preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown responsive preset: %s", preset)
+		}
+		widths = presetWidths
+	}
+
+	if len(widths) > maxResponsiveWidths {
+		return nil, fmt.Errorf("responsive jobs accept at most %d widths", maxResponsiveWidths)
+	}
+
+	resolved := make([]int, 0, len(widths))
+	seen := make(map[int]bool)
+	for _, w := range widths {
+		if w <= 0 {
+			return nil, fmt.Errorf("invalid responsive width: %d", w)
+		}
+		if w > maxResponsiveWidth {
+			return nil, fmt.Errorf("responsive width %d exceeds the limit of %d pixels", w, maxResponsiveWidth)
+		}
+		if !seen[w] {
+			seen[w] = true
+			resolved = append(resolved, w)
+		}
+	}
+
+	sort.Ints(resolved)
+	return resolved, nil
+}
+
+// srcset builds the value of an HTML srcset attribute from the variants URLs.
+func srcset(urls []string, widths []int) string {
+	entries := make([]string, len(urls))
+	for i := range urls {
+		entries[i] = fmt.Sprintf("%s %dw", urls[i], widths[i])
+	}
+	return strings.Join(entries, ", ")
+}
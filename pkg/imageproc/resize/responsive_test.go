@@ -0,0 +1,89 @@
+package resize
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResponsiveWidths(t *testing.T) {
+	tests := []struct {
+		name    string
+		preset  string
+		widths  []int
+		want    []int
+		wantErr bool
+	}{
+		{"preset", "thumbnails", nil, []int{64, 128, 256}, false},
+		{"explicit widths", "", []int{800, 400}, []int{400, 800}, false},
+		{"explicit widths over the preset", "web-responsive", []int{100}, []int{100}, false},
+		{"duplicates", "", []int{640, 320, 640, 320}, []int{320, 640}, false},
+		{"no widths nor preset", "", nil, nil, true},
+		{"unknown preset", "posters", nil, nil, true},
+		{"zero width", "", []int{320, 0}, nil, true},
+		{"negative width", "", []int{-320}, nil, true},
+		{"widest width", "", []int{maxResponsiveWidth}, []int{maxResponsiveWidth}, false},
+		{"too wide", "", []int{320, maxResponsiveWidth + 1}, nil, true},
+		{"most widths", "", manyWidths(maxResponsiveWidths), manyWidths(maxResponsiveWidths), false},
+		{"too many widths", "", manyWidths(maxResponsiveWidths + 1), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResponsiveWidths(tt.preset, tt.widths)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResponsiveWidths() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ResponsiveWidths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// manyWidths returns n ascending widths.
+func manyWidths(n int) []int {
+	widths := make([]int, n)
+	for i := range widths {
+		widths[i] = (i + 1) * 100
+	}
+	return widths
+}
+
+func TestResponsiveWidthsKeepsInputs(t *testing.T) {
+	widths := []int{640, 320}
+	if _, err := ResponsiveWidths("", widths); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(widths, []int{640, 320}) {
+		t.Errorf("ResponsiveWidths() reordered its input to %v", widths)
+	}
+
+	preset := slices.Clone(responsivePresets["web-responsive"])
+	if _, err := ResponsiveWidths("web-responsive", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(responsivePresets["web-responsive"], preset) {
+		t.Errorf("ResponsiveWidths() changed the preset to %v", responsivePresets["web-responsive"])
+	}
+}
+
+func TestSrcset(t *testing.T) {
+	tests := []struct {
+		name   string
+		urls   []string
+		widths []int
+		want   string
+	}{
+		{"none", nil, nil, ""},
+		{"one", []string{"a.png"}, []int{320}, "a.png 320w"},
+		{"several", []string{"a.png", "b.png"}, []int{320, 640}, "a.png 320w, b.png 640w"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := srcset(tt.urls, tt.widths); got != tt.want {
+				t.Errorf("srcset() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
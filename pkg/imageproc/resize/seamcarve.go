@@ -0,0 +1,347 @@
+package resize
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	util "github.com/IlfGauhnith/GophicProcessor/pkg/util"
+)
+
+// defaultSeamCarveMaxPixels bounds the size of the images carved when
+// SEAMCARVE_MAX_PIXELS is not set. Carving costs a full energy pass per seam.
+const defaultSeamCarveMaxPixels = 1_000_000
+
+// maskEnergy is added to (protect) or removed from (remove) the energy
+// of masked pixels, far above any gradient energy.
+const maskEnergy = 1e7
+
+// SeamCarveStrategy changes the aspect ratio of an image by removing or inserting
+// low energy seams, paths of pixels crossing the image, instead of scaling it.
+//
+// Pixels marked in ProtectMask are avoided by seams, while seams go through the pixels
+// marked in RemoveMask first. Masks are stretched to the size of the image and a pixel
+// is marked when it is bright and opaque.
+//
+// Images that are, or would grow through seam insertion, above MaxPixels are scaled
+// with Lanczos3 instead.
+type SeamCarveStrategy struct {
+	ProtectMask image.Image
+	RemoveMask  image.Image
+	MaxPixels   int
+}
+
+// NewSeamCarveStrategy creates a strategy with the pixel limit read from SEAMCARVE_MAX_PIXELS.
+func NewSeamCarveStrategy() *SeamCarveStrategy {
+	maxPixels := defaultSeamCarveMaxPixels
+	if value, err := strconv.Atoi(os.Getenv("SEAMCARVE_MAX_PIXELS")); err == nil && value > 0 {
+		maxPixels = value
+	}
+	return &SeamCarveStrategy{MaxPixels: maxPixels}
+}
+
+// ValidateMasks checks that the base64 protect and remove masks of a job can be decoded.
+func ValidateMasks(protect string, remove string) error {
+	return (&SeamCarveStrategy{}).loadMasks(protect, remove)
+}
+
+// loadMasks decodes the base64 protect and remove masks of a job. Empty masks are ignored.
+func (s *SeamCarveStrategy) loadMasks(protect string, remove string) error {
+	var err error
+	if protect != "" {
+		if s.ProtectMask, err = util.DecodeBase64Image(protect); err != nil {
+			return fmt.Errorf("failed to decode protect mask: %v", err)
+		}
+	}
+	if remove != "" {
+		if s.RemoveMask, err = util.DecodeBase64Image(remove); err != nil {
+			return fmt.Errorf("failed to decode remove mask: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *SeamCarveStrategy) Resize(ctx context.Context, img image.Image, width uint, height uint) (image.Image, error) {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return img, ctx.Err()
+	}
+
+	// Like the other strategies, a zero dimension keeps the aspect ratio.
+	targetW, targetH := int(width), int(height)
+	switch {
+	case targetW == 0 && targetH == 0:
+		return img, ctx.Err()
+	case targetW == 0:
+		targetW = max(bounds.Dx()*targetH/bounds.Dy(), 1)
+	case targetH == 0:
+		targetH = max(bounds.Dy()*targetW/bounds.Dx(), 1)
+	}
+
+	// The width is carved first, then the height: the image is never larger than
+	// the widest and tallest of the input and the target.
+	largestW, largestH := max(bounds.Dx(), targetW), max(bounds.Dy(), targetH)
+	if s.MaxPixels > 0 && largestW*largestH > s.MaxPixels {
+		logger.Log.Warnf("Carving %dx%d to %dx%d exceeds the seam carving limit of %d pixels, scaling instead",
+			bounds.Dx(), bounds.Dy(), targetW, targetH, s.MaxPixels)
+		return resizeTo(ctx, &Lanczos3Strategy{}, img, width, height)
+	}
+
+	c := newCarver(img, s.ProtectMask, s.RemoveMask)
+	c, err := c.resizeWidth(ctx, targetW)
+	if err != nil {
+		return nil, err
+	}
+	c, err = c.transpose().resizeWidth(ctx, targetH)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.transpose().image(), nil
+}
+
+// carvedPixel is a pixel of the image being carved.
+type carvedPixel struct {
+	color color.NRGBA
+	// mask is positive for protected pixels and negative for pixels to remove.
+	mask int8
+	// origin is the column the pixel had when the current pass started.
+	origin int32
+}
+
+// carver holds the image being carved row by row.
+type carver struct {
+	rows [][]carvedPixel
+}
+
+func newCarver(img image.Image, protect image.Image, remove image.Image) *carver {
+	bounds := img.Bounds()
+	protectMask := maskSampler(protect, bounds)
+	removeMask := maskSampler(remove, bounds)
+
+	c := &carver{rows: make([][]carvedPixel, bounds.Dy())}
+	for y := range c.rows {
+		row := make([]carvedPixel, bounds.Dx())
+		for x := range row {
+			row[x].color = color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			if removeMask(x, y) {
+				row[x].mask = -1
+			} else if protectMask(x, y) {
+				row[x].mask = 1
+			}
+		}
+		c.rows[y] = row
+	}
+	return c
+}
+
+// maskSampler returns whether a pixel of an image of the given bounds is marked,
+// stretching the mask to those bounds.
+func maskSampler(mask image.Image, bounds image.Rectangle) func(x, y int) bool {
+	if mask == nil || mask.Bounds().Empty() {
+		return func(x, y int) bool { return false }
+	}
+
+	mb := mask.Bounds()
+	return func(x, y int) bool {
+		mx := mb.Min.X + x*mb.Dx()/bounds.Dx()
+		my := mb.Min.Y + y*mb.Dy()/bounds.Dy()
+		r, g, b, a := mask.At(mx, my).RGBA()
+		return a >= 0x8000 && (r+g+b)/3 >= 0x8000
+	}
+}
+
+func (c *carver) width() int {
+	if len(c.rows) == 0 {
+		return 0
+	}
+	return len(c.rows[0])
+}
+
+func (c *carver) height() int {
+	return len(c.rows)
+}
+
+func (c *carver) image() image.Image {
+	out := image.NewNRGBA(image.Rect(0, 0, c.width(), c.height()))
+	for y, row := range c.rows {
+		for x, p := range row {
+			out.SetNRGBA(x, y, p.color)
+		}
+	}
+	return out
+}
+
+func (c *carver) transpose() *carver {
+	out := &carver{rows: make([][]carvedPixel, c.width())}
+	for x := range out.rows {
+		out.rows[x] = make([]carvedPixel, c.height())
+		for y := range c.rows {
+			out.rows[x][y] = c.rows[y][x]
+		}
+	}
+	return out
+}
+
+// resizeWidth removes or inserts vertical seams until the image is target pixels wide.
+// The context is checked before each seam and each insertion pass.
+func (c *carver) resizeWidth(ctx context.Context, target int) (*carver, error) {
+	for c.width() > target {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c.removeSeam(c.findSeam())
+	}
+
+	// Inserting the same seam twice would stretch a single column, so at most
+	// half of the current width is inserted per pass.
+	for c.width() < target {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		width := c.width()
+		count := min(target-width, max(width/2, 1))
+		var err error
+		if c, err = c.insertSeams(ctx, count); err != nil {
+			return nil, err
+		}
+		if c.width() <= width {
+			return nil, fmt.Errorf("seam insertion made no progress at width %d", width)
+		}
+	}
+	return c, nil
+}
+
+// energy computes the dual gradient energy of every pixel, plus the mask energy.
+func (c *carver) energy() [][]float64 {
+	w, h := c.width(), c.height()
+	energy := make([][]float64, h)
+
+	at := func(x, y int) color.NRGBA {
+		return c.rows[min(max(y, 0), h-1)][min(max(x, 0), w-1)].color
+	}
+
+	for y := 0; y < h; y++ {
+		energy[y] = make([]float64, w)
+		for x := 0; x < w; x++ {
+			e := gradient(at(x-1, y), at(x+1, y)) + gradient(at(x, y-1), at(x, y+1))
+			e += float64(c.rows[y][x].mask) * maskEnergy
+			energy[y][x] = e
+		}
+	}
+	return energy
+}
+
+func gradient(a color.NRGBA, b color.NRGBA) float64 {
+	dr := float64(a.R) - float64(b.R)
+	dg := float64(a.G) - float64(b.G)
+	db := float64(a.B) - float64(b.B)
+	return dr*dr + dg*dg + db*db
+}
+
+// findSeam returns, for each row, the column of the lowest energy vertical seam.
+func (c *carver) findSeam() []int {
+	w, h := c.width(), c.height()
+	cost := c.energy()
+
+	for y := 1; y < h; y++ {
+		for x := 0; x < w; x++ {
+			best := cost[y-1][x]
+			if x > 0 {
+				best = math.Min(best, cost[y-1][x-1])
+			}
+			if x < w-1 {
+				best = math.Min(best, cost[y-1][x+1])
+			}
+			cost[y][x] += best
+		}
+	}
+
+	seam := make([]int, h)
+	for x := 1; x < w; x++ {
+		if cost[h-1][x] < cost[h-1][seam[h-1]] {
+			seam[h-1] = x
+		}
+	}
+
+	for y := h - 2; y >= 0; y-- {
+		prev := seam[y+1]
+		seam[y] = prev
+		for _, x := range []int{prev - 1, prev + 1} {
+			if x >= 0 && x < w && cost[y][x] < cost[y][seam[y]] {
+				seam[y] = x
+			}
+		}
+	}
+	return seam
+}
+
+func (c *carver) removeSeam(seam []int) {
+	for y, x := range seam {
+		c.rows[y] = append(c.rows[y][:x], c.rows[y][x+1:]...)
+	}
+}
+
+// insertSeams widens the image by count pixels. The count lowest energy seams are
+// found by carving a copy of the image, then each of them is duplicated in the
+// original image, the new pixel being the average of the seam and its right neighbour.
+func (c *carver) insertSeams(ctx context.Context, count int) (*carver, error) {
+	work := &carver{rows: make([][]carvedPixel, c.height())}
+	for y, row := range c.rows {
+		work.rows[y] = make([]carvedPixel, len(row))
+		for x, p := range row {
+			p.origin = int32(x)
+			work.rows[y][x] = p
+		}
+	}
+
+	// duplicates[y][x] is the number of seams going through column x of row y.
+	duplicates := make([][]int, c.height())
+	for y := range duplicates {
+		duplicates[y] = make([]int, c.width())
+	}
+
+	// A single column is its own seam, carving it away duplicates it.
+	for i := 0; i < count && work.width() > 0; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		seam := work.findSeam()
+		for y, x := range seam {
+			duplicates[y][work.rows[y][x].origin]++
+		}
+		work.removeSeam(seam)
+	}
+
+	out := &carver{rows: make([][]carvedPixel, c.height())}
+	for y, row := range c.rows {
+		newRow := make([]carvedPixel, 0, len(row)+count)
+		for x, p := range row {
+			newRow = append(newRow, p)
+
+			next := p
+			if x+1 < len(row) {
+				next = row[x+1]
+			}
+			for n := 0; n < duplicates[y][x]; n++ {
+				newRow = append(newRow, carvedPixel{color: averageColor(p.color, next.color), mask: p.mask})
+			}
+		}
+		out.rows[y] = newRow
+	}
+	return out, nil
+}
+
+func averageColor(a color.NRGBA, b color.NRGBA) color.NRGBA {
+	return color.NRGBA{
+		R: uint8((int(a.R) + int(b.R)) / 2),
+		G: uint8((int(a.G) + int(b.G)) / 2),
+		B: uint8((int(a.B) + int(b.B)) / 2),
+		A: uint8((int(a.A) + int(b.A)) / 2),
+	}
+}
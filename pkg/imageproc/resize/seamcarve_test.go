@@ -0,0 +1,141 @@
+package resize
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func gradientImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 7), G: uint8(y * 13), B: uint8(x * y), A: 255})
+		}
+	}
+	return img
+}
+
+func TestSeamCarveResize(t *testing.T) {
+	tests := []struct {
+		name          string
+		srcW, srcH    int
+		width, height uint
+		wantW, wantH  int
+	}{
+		{"shrink both", 40, 30, 20, 15, 20, 15},
+		{"widen", 20, 10, 45, 10, 45, 10},
+		{"widen and shrink", 30, 30, 50, 10, 50, 10},
+		{"keep ratio from width", 40, 20, 20, 0, 20, 10},
+		{"keep ratio from height", 40, 20, 0, 10, 20, 10},
+		{"1px wide", 1, 20, 10, 20, 10, 20},
+		{"1px tall", 50, 1, 20, 10, 20, 10},
+		{"single pixel", 1, 1, 5, 5, 5, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			out, err := (&SeamCarveStrategy{}).Resize(ctx, gradientImage(tt.srcW, tt.srcH), tt.width, tt.height)
+			if err != nil {
+				t.Fatalf("Resize() error = %v", err)
+			}
+			if got := out.Bounds(); got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+				t.Errorf("Resize() size = %dx%d, want %dx%d", got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestSeamCarveMaxPixels(t *testing.T) {
+	tests := []struct {
+		name          string
+		srcW, srcH    int
+		width, height uint
+		wantCarved    bool
+	}{
+		{"within the limit", 20, 20, 30, 20, true},
+		{"input above the limit", 40, 30, 20, 15, false},
+		{"insertion above the limit", 20, 20, 60, 20, false},
+		{"growing both sides above the limit", 20, 20, 25, 45, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			src := gradientImage(tt.srcW, tt.srcH)
+
+			out, err := (&SeamCarveStrategy{MaxPixels: 1000}).Resize(ctx, src, tt.width, tt.height)
+			if err != nil {
+				t.Fatalf("Resize() error = %v", err)
+			}
+			scaled, err := resizeTo(ctx, &Lanczos3Strategy{}, src, tt.width, tt.height)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if carved := !sameImage(out, scaled); carved != tt.wantCarved {
+				t.Errorf("Resize() carved = %v, want %v", carved, tt.wantCarved)
+			}
+		})
+	}
+}
+
+// sameImage reports whether a and b have the same size and pixels.
+func sameImage(a, b image.Image) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return false
+	}
+	for y := 0; y < a.Bounds().Dy(); y++ {
+		for x := 0; x < a.Bounds().Dx(); x++ {
+			if a.At(a.Bounds().Min.X+x, a.Bounds().Min.Y+y) != b.At(b.Bounds().Min.X+x, b.Bounds().Min.Y+y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestSeamCarveResizeHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := (&SeamCarveStrategy{}).Resize(ctx, gradientImage(50, 1), 20, 10); err != context.Canceled {
+		t.Errorf("Resize() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestSeamCarveProtectMask(t *testing.T) {
+	// A bright column in the middle is protected, narrowing must keep it.
+	src := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	mask := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: 10, G: 10, B: 10, A: 255})
+		}
+		src.SetNRGBA(10, y, color.NRGBA{R: 255, A: 255})
+		mask.SetNRGBA(10, y, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	}
+
+	out, err := (&SeamCarveStrategy{ProtectMask: mask}).Resize(context.Background(), src, 5, 10)
+	if err != nil {
+		t.Fatalf("Resize() error = %v", err)
+	}
+
+	b := out.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		found := false
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, g, _, _ := out.At(x, y).RGBA(); r>>8 == 255 && g>>8 == 0 {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("protected column removed from row %d", y)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	crop "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/crop"
+	quantize "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/quantize"
+	redact "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/redact"
+	tile "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/tile"
+	trim "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/trim"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+const (
+	// FitStretch resizes to the target size, ignoring the aspect ratio (default).
+	FitStretch = "stretch"
+	// FitCover crops the source to the target aspect ratio before resizing.
+	FitCover = "cover"
+	// FitCrop cuts a window of the target size out of the source, without resizing.
+	FitCrop = "crop"
+)
+
+const (
+	// FormatJPEG encodes still outputs as JPEG (default).
+	FormatJPEG = "jpeg"
+	// FormatPNG encodes still outputs as lossless PNG.
+	FormatPNG = "png"
+	// FormatPNG8 encodes still outputs as 8-bit indexed PNG, quantized to at most 256 colors.
+	FormatPNG8 = "png8"
+)
+
+// OutputFormat returns the format of the still outputs of a job. Quantized jobs
+// default to PNG8 and can't be encoded as JPEG, which would undo the palette.
+// Animations are always encoded as GIF.
+func OutputFormat(format string, quantized bool) (string, error) {
+	switch format {
+	case "":
+		if quantized {
+			return FormatPNG8, nil
+		}
+		return FormatJPEG, nil
+	case FormatJPEG:
+		if quantized {
+			return "", fmt.Errorf("quantized images can't be encoded as jpeg")
+		}
+		return format, nil
+	case FormatPNG, FormatPNG8:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown output format: %s", format)
+}
+
+// ValidFit reports whether fit is a known fit mode. Empty means stretch.
+func ValidFit(fit string) bool {
+	switch fit {
+	case "", FitStretch, FitCover, FitCrop:
+		return true
+	}
+	return false
+}
+
+// source is a decoded input image, either a still image, a still image too
+// large to be held decoded, or an animated GIF.
+type source struct {
+	still     image.Image
+	large     *largeSource
+	animation *gif.GIF
+
+	// transforms are applied to every frame of an animation before it is resized.
+	// Still images are transformed right away.
+	transforms []func(image.Image) image.Image
+	// offset is the position in the input of the frames of an animation once cropped.
+	offset image.Point
+
+	// format is the output format of still images, see OutputFormat.
+	// quantize tells how PNG8 outputs and animation frames are quantized, nil
+	// when the job didn't ask for it.
+	format   string
+	quantize *model.QuantizeOptions
+}
+
+// output is an encoded image ready to be uploaded.
+type output struct {
+	data      []byte
+	extension string
+	width     int
+	height    int
+
+	// preview is the resized image, or its first frame for animations.
+	preview image.Image
+}
+
+// decodeSource decodes an input image. When stream is set, still images above
+// the tiling threshold are read in passes instead, see largeSource.
+func decodeSource(ctx context.Context, data []byte, stream bool) (*source, error) {
+	// image.Decode only returns the first frame of a GIF,
+	// animations are handled frame by frame instead.
+	if animation := decodeAnimatedGIF(data); animation != nil {
+		return &source{animation: animation}, nil
+	}
+
+	if config, format, err := image.DecodeConfig(bytes.NewReader(data)); stream && err == nil {
+		if size := image.Pt(config.Width, config.Height); aboveTileThreshold(size) {
+			large, err := newLargeSource(ctx, data, format, size)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode image: %w", err)
+			}
+			return &source{large: large}, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	return &source{still: img}, nil
+}
+
+// transform registers an operation applied to the image, or to each frame of an animation.
+// Operations must not modify the image they receive.
+func (s *source) transform(fn func(image.Image) image.Image) {
+	if s.animation != nil {
+		s.transforms = append(s.transforms, fn)
+		return
+	}
+	s.still = fn(s.still)
+}
+
+// redact redacts regions of the image, or of each frame of an animation.
+func (s *source) redact(ctx context.Context, regions []model.Redaction) error {
+	if s.large != nil {
+		return s.large.redact(ctx, regions)
+	}
+	s.transform(func(img image.Image) image.Image {
+		return redact.Apply(img, regions)
+	})
+	return nil
+}
+
+// crop narrows the source to window, given in the coordinates of bounds.
+// Still images keep sharing the pixels of the decoded input.
+func (s *source) crop(window image.Rectangle) {
+	switch {
+	case s.large != nil:
+		s.large.window = window.Intersect(s.large.window)
+	case s.animation != nil:
+		// Frames are drawn on a canvas reused for the next one, they are copied.
+		s.transforms = append(s.transforms, func(img image.Image) image.Image {
+			return crop.Crop(img, window)
+		})
+		s.offset = s.offset.Add(window.Min)
+	default:
+		s.still = crop.Sub(s.still, window)
+	}
+}
+
+// box returns window, given in the coordinates of bounds, as a box of the input image.
+func (s *source) box(window image.Rectangle) *model.Box {
+	window = window.Add(s.offset)
+	return &model.Box{X: window.Min.X, Y: window.Min.Y, Width: window.Dx(), Height: window.Dy()}
+}
+
+func (s *source) bounds() image.Rectangle {
+	if s.large != nil {
+		return s.large.window
+	}
+	return s.frame().Bounds()
+}
+
+// frame returns the still image, or the first frame of an animation
+// drawn on the full canvas with the transforms applied.
+// Large images are only available through their reduced proxy.
+func (s *source) frame() image.Image {
+	if s.large != nil {
+		return s.large.frame()
+	}
+	if s.animation == nil {
+		return s.still
+	}
+
+	first := s.animation.Image[0]
+	canvas := image.NewRGBA(image.Rect(0, 0, s.animation.Config.Width, s.animation.Config.Height))
+	if canvas.Bounds().Empty() {
+		canvas = image.NewRGBA(first.Bounds())
+	}
+	draw.Draw(canvas, first.Bounds(), first, first.Bounds().Min, draw.Over)
+
+	var img image.Image = canvas
+	for _, fn := range s.transforms {
+		img = fn(img)
+	}
+	return img
+}
+
+// render resizes the source and encodes it, in the source format for still images and GIF for animations.
+// A zero width and height keep the current size.
+func (s *source) render(ctx context.Context, strategy ResizeStrategy, width uint, height uint) (*output, error) {
+	if s.animation != nil {
+		encoded, err := resizeAnimatedGIF(ctx, s.animation, s.transforms, strategy, width, height, s.quantize)
+		if err != nil {
+			return nil, err
+		}
+
+		firstFrame, err := gif.Decode(bytes.NewReader(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read resized animation: %v", err)
+		}
+
+		bounds := firstFrame.Bounds()
+		return &output{data: encoded, extension: "gif", width: bounds.Dx(), height: bounds.Dy(), preview: firstFrame}, nil
+	}
+
+	var resizedImg image.Image
+	var err error
+	if s.large != nil {
+		resizedImg, err = s.large.resize(ctx, strategy, width, height)
+	} else {
+		resizedImg, err = resizeTo(ctx, strategy, s.still, width, height)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	extension := "jpg"
+	switch s.format {
+	case FormatPNG:
+		extension = "png"
+		err = png.Encode(&buf, resizedImg)
+	case FormatPNG8:
+		extension = "png"
+		var opts model.QuantizeOptions
+		if s.quantize != nil {
+			opts = *s.quantize
+		}
+		resizedImg = quantize.Quantize(resizedImg, opts)
+		err = png.Encode(&buf, resizedImg)
+	default:
+		err = jpeg.Encode(&buf, resizedImg, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode resized image: %v", err)
+	}
+
+	bounds := resizedImg.Bounds()
+	return &output{data: buf.Bytes(), extension: extension, width: bounds.Dx(), height: bounds.Dy(), preview: resizedImg}, nil
+}
+
+// resizeTo resizes img with strategy, skipping the work when the image already has the requested size.
+// Images above the tiling threshold are resampled in strips, see tiledKernel.
+func resizeTo(ctx context.Context, strategy ResizeStrategy, img image.Image, width uint, height uint) (image.Image, error) {
+	bounds := img.Bounds()
+	if (width == 0 && height == 0) || (int(width) == bounds.Dx() && int(height) == bounds.Dy()) {
+		return img, ctx.Err()
+	}
+
+	if kernel, ok := tiledKernel(strategy, bounds); ok {
+		w, h := outputSize(bounds.Size(), width, height)
+		logger.Log.Infof("Resizing %dx%d image in strips", bounds.Dx(), bounds.Dy())
+		return tile.Resize(ctx, img, w, h, kernel)
+	}
+
+	return strategy.Resize(ctx, img, width, height)
+}
+
+// applyTrim removes the uniform border of the source when the job asks for it.
+// It returns the kept window, or nil when the job doesn't trim.
+func applyTrim(job model.ResizeJob, src *source) (*model.Box, error) {
+	if job.Trim == nil {
+		return nil, nil
+	}
+	if err := trim.Validate(job.Trim.Tolerance, job.Trim.Padding); err != nil {
+		return nil, err
+	}
+
+	// Animations are trimmed to the border of their first frame.
+	var window image.Rectangle
+	if src.large != nil {
+		window = src.large.trimWindow(job.Trim.Tolerance, job.Trim.Padding)
+	} else {
+		window = trim.Window(src.frame(), job.Trim.Tolerance, job.Trim.Padding)
+	}
+	box := src.box(window)
+	if window != src.bounds() {
+		src.crop(window)
+	}
+
+	return box, nil
+}
+
+// applyFit crops the source according to the job fit and gravity.
+// It returns the kept window, or nil when the job doesn't crop.
+func applyFit(job model.ResizeJob, src *source) (*model.Box, error) {
+	var window image.Rectangle
+	var err error
+
+	switch {
+	case job.Fit == "" || job.Fit == FitStretch:
+		return nil, nil
+	case src.large != nil:
+		window, err = src.large.fitWindow(job.Fit, job.TargetWidth, job.TargetHeight, job.Gravity)
+	case job.Fit == FitCover:
+		window, err = crop.CoverWindow(src.frame(), job.TargetWidth, job.TargetHeight, job.Gravity)
+	case job.Fit == FitCrop:
+		window, err = crop.CropWindow(src.frame(), job.TargetWidth, job.TargetHeight, job.Gravity)
+	default:
+		return nil, fmt.Errorf("unknown fit: %s", job.Fit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	box := src.box(window)
+	src.crop(window)
+	return box, nil
+}
@@ -1,41 +1,57 @@
 package resize
 
 import (
+	"context"
 	"image"
 
 	"github.com/nfnt/resize"
 )
 
+// ResizeStrategy resizes an image to width x height, a zero dimension keeping the aspect ratio.
+// Strategies give up with the context error once ctx is done.
 type ResizeStrategy interface {
-	Resize(img image.Image, width uint, height uint) image.Image
+	Resize(ctx context.Context, img image.Image, width uint, height uint) (image.Image, error)
+}
+
+// resizeWith runs one of the nfnt/resize interpolations. They can't be interrupted,
+// the context is checked before starting and once they are done.
+func resizeWith(ctx context.Context, img image.Image, width uint, height uint, interp resize.InterpolationFunction) (image.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resized := resize.Resize(width, height, img, interp)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return resized, nil
 }
 
 type BilinearStrategy struct{}
 
-func (b *BilinearStrategy) Resize(img image.Image, width uint, height uint) image.Image {
-	return resize.Resize(width, height, img, resize.Bilinear)
+func (b *BilinearStrategy) Resize(ctx context.Context, img image.Image, width uint, height uint) (image.Image, error) {
+	return resizeWith(ctx, img, width, height, resize.Bilinear)
 }
 
 type NearestNeighborStrategy struct{}
 
-func (n *NearestNeighborStrategy) Resize(img image.Image, width uint, height uint) image.Image {
-	return resize.Resize(width, height, img, resize.NearestNeighbor)
+func (n *NearestNeighborStrategy) Resize(ctx context.Context, img image.Image, width uint, height uint) (image.Image, error) {
+	return resizeWith(ctx, img, width, height, resize.NearestNeighbor)
 }
 
 type BicubicStrategy struct{}
 
-func (b *BicubicStrategy) Resize(img image.Image, width uint, height uint) image.Image {
-	return resize.Resize(width, height, img, resize.Bicubic)
+func (b *BicubicStrategy) Resize(ctx context.Context, img image.Image, width uint, height uint) (image.Image, error) {
+	return resizeWith(ctx, img, width, height, resize.Bicubic)
 }
 
 type Lanczos2Strategy struct{}
 
-func (l *Lanczos2Strategy) Resize(img image.Image, width uint, height uint) image.Image {
-	return resize.Resize(width, height, img, resize.Lanczos2)
+func (l *Lanczos2Strategy) Resize(ctx context.Context, img image.Image, width uint, height uint) (image.Image, error) {
+	return resizeWith(ctx, img, width, height, resize.Lanczos2)
 }
 
 type Lanczos3Strategy struct{}
 
-func (l *Lanczos3Strategy) Resize(img image.Image, width uint, height uint) image.Image {
-	return resize.Resize(width, height, img, resize.Lanczos3)
+func (l *Lanczos3Strategy) Resize(ctx context.Context, img image.Image, width uint, height uint) (image.Image, error) {
+	return resizeWith(ctx, img, width, height, resize.Lanczos3)
 }
@@ -0,0 +1,79 @@
+package resize
+
+import (
+	"image"
+	"os"
+	"strconv"
+
+	tile "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/tile"
+)
+
+// defaultTileThresholdPixels is the size above which images are resampled in strips
+// when TILE_THRESHOLD_PIXELS is not set.
+const defaultTileThresholdPixels = 25_000_000
+
+// tileThresholdPixels reads the tiling threshold. Zero or a negative value disables tiling.
+func tileThresholdPixels() int {
+	value, err := strconv.Atoi(os.Getenv("TILE_THRESHOLD_PIXELS"))
+	if err != nil {
+		return defaultTileThresholdPixels
+	}
+	return value
+}
+
+// aboveTileThreshold reports whether an image of the given size is resampled in strips.
+func aboveTileThreshold(size image.Point) bool {
+	threshold := tileThresholdPixels()
+	return threshold > 0 && size.X*size.Y > threshold
+}
+
+// outputSize completes a zero width or height from the aspect ratio of an image of
+// the given size. It rounds like the resizers behind the strategies, so that an
+// image gets the same size whether it is resampled in strips or not.
+func outputSize(size image.Point, width uint, height uint) (int, int) {
+	w, h := int(width), int(height)
+	switch {
+	case w == 0 && h == 0:
+		return size.X, size.Y
+	case w == 0:
+		w = int(0.7 + float64(size.X)/(float64(size.Y)/float64(h)))
+	case h == 0:
+		h = int(0.7 + float64(size.Y)/(float64(size.X)/float64(w)))
+	}
+	return max(w, 1), max(h, 1)
+}
+
+// tiledKernel returns the strip resampling kernel matching strategy when an image
+// of the given bounds is above the tiling threshold.
+//
+// The resizers behind the strategies allocate several full size intermediate
+// buffers, which a worker running a job per CPU can't afford for very large scans.
+// Strategies without a separable kernel, such as seam carving, are never tiled.
+func tiledKernel(strategy ResizeStrategy, bounds image.Rectangle) (tile.Kernel, bool) {
+	if !aboveTileThreshold(bounds.Size()) {
+		return tile.Kernel{}, false
+	}
+	return stripKernel(strategy)
+}
+
+// stripKernel returns the strip resampling kernel matching strategy, if any.
+func stripKernel(strategy ResizeStrategy) (tile.Kernel, bool) {
+	var algorithm string
+	switch strategy.(type) {
+	case *NearestNeighborStrategy:
+		algorithm = "nearest"
+	case *BilinearStrategy:
+		algorithm = "bilinear"
+	case *BicubicStrategy:
+		algorithm = "bicubic"
+	case *Lanczos2Strategy:
+		algorithm = "lanczos2"
+	case *Lanczos3Strategy:
+		algorithm = "lanczos3"
+	default:
+		return tile.Kernel{}, false
+	}
+
+	kernel, ok := tile.Kernels[algorithm]
+	return kernel, ok
+}
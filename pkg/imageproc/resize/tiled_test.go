@@ -0,0 +1,145 @@
+package resize
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// smoothImage has no edges, so that the resamplers only differ by rounding.
+func smoothImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(x * 255 / w),
+				G: uint8(y * 255 / h),
+				B: uint8(128 + 100*math.Sin(float64(x+y)/20)),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// meanDifference is the mean absolute difference of the channels of two images of the same size.
+func meanDifference(a image.Image, b image.Image) float64 {
+	var sum float64
+	bounds := a.Bounds()
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c1 := color.RGBAModel.Convert(a.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			c2 := color.RGBAModel.Convert(b.At(b.Bounds().Min.X+x, b.Bounds().Min.Y+y)).(color.RGBA)
+			sum += math.Abs(float64(c1.R)-float64(c2.R)) +
+				math.Abs(float64(c1.G)-float64(c2.G)) +
+				math.Abs(float64(c1.B)-float64(c2.B)) +
+				math.Abs(float64(c1.A)-float64(c2.A))
+		}
+	}
+	return sum / float64(bounds.Dx()*bounds.Dy()*4)
+}
+
+func TestTiledKernel(t *testing.T) {
+	t.Setenv("TILE_THRESHOLD_PIXELS", "100")
+
+	tests := []struct {
+		name      string
+		algorithm string
+		bounds    image.Rectangle
+		want      bool
+	}{
+		{"below threshold", "lanczos3", image.Rect(0, 0, 10, 10), false},
+		{"nearest", "nearest", image.Rect(0, 0, 10, 11), true},
+		{"bilinear", "bilinear", image.Rect(0, 0, 10, 11), true},
+		{"bicubic", "bicubic", image.Rect(0, 0, 10, 11), true},
+		{"lanczos2", "lanczos2", image.Rect(0, 0, 10, 11), true},
+		{"lanczos3", "lanczos3", image.Rect(5, 5, 15, 16), true},
+		{"seam carving", "seamcarve", image.Rect(0, 0, 100, 100), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := GetResizeStrategy(tt.algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, got := tiledKernel(strategy, tt.bounds); got != tt.want {
+				t.Errorf("tiledKernel() tiled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTileThresholdPixels(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", defaultTileThresholdPixels},
+		{"invalid", defaultTileThresholdPixels},
+		{"1000", 1000},
+		{"0", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TILE_THRESHOLD_PIXELS", tt.value)
+			if got := tileThresholdPixels(); got != tt.want {
+				t.Errorf("tileThresholdPixels() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResizeToTiledMatchesDirect(t *testing.T) {
+	// maxDifference bounds the mean difference of the channels, from 0 to 255.
+	// The kernels differ slightly from the ones of the direct resizers.
+	const maxDifference = 2.0
+
+	tests := []struct {
+		name          string
+		algorithm     string
+		width, height uint
+		wantW, wantH  int
+	}{
+		{"bilinear down", "bilinear", 60, 45, 60, 45},
+		{"bicubic down", "bicubic", 50, 0, 50, 38},
+		{"lanczos2 up", "lanczos2", 0, 200, 267, 200},
+		{"lanczos3 down", "lanczos3", 33, 70, 33, 70},
+		{"lanczos3 up", "lanczos3", 300, 300, 300, 300},
+		{"nearest down", "nearest", 40, 30, 40, 30},
+	}
+
+	src := smoothImage(160, 120)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := GetResizeStrategy(tt.algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Setenv("TILE_THRESHOLD_PIXELS", "0")
+			direct, err := resizeTo(context.Background(), strategy, src, tt.width, tt.height)
+			if err != nil {
+				t.Fatalf("direct resizeTo() error = %v", err)
+			}
+
+			t.Setenv("TILE_THRESHOLD_PIXELS", "1000")
+			tiled, err := resizeTo(context.Background(), strategy, src, tt.width, tt.height)
+			if err != nil {
+				t.Fatalf("tiled resizeTo() error = %v", err)
+			}
+
+			for name, img := range map[string]image.Image{"direct": direct, "tiled": tiled} {
+				if size := img.Bounds().Size(); size != image.Pt(tt.wantW, tt.wantH) {
+					t.Fatalf("%s size = %v, want %dx%d", name, size, tt.wantW, tt.wantH)
+				}
+			}
+			if d := meanDifference(direct, tiled); d > maxDifference {
+				t.Errorf("tiled output differs from direct one by %.2f on average, want at most %.2f", d, maxDifference)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package resize
+
+import (
+	"os"
+	"time"
+)
+
+// Codes of the errors of images stopped before they were processed.
+const (
+	CodeTimeout   = "timeout"
+	CodeCancelled = "cancelled"
+)
+
+const (
+	defaultJobTimeout   = 10 * time.Minute
+	defaultImageTimeout = 2 * time.Minute
+)
+
+// Timeouts returns how long a whole job and each of its images may take,
+// from JOB_TIMEOUT and IMAGE_TIMEOUT as Go durations such as "90s".
+// A zero or negative duration disables the timeout.
+func Timeouts() (job time.Duration, image time.Duration) {
+	return durationFromEnv("JOB_TIMEOUT", defaultJobTimeout), durationFromEnv("IMAGE_TIMEOUT", defaultImageTimeout)
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
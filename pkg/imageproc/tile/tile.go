@@ -0,0 +1,329 @@
+package tile
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Kernel is a separable resampling filter, Weight being zero outside [-Support, Support].
+type Kernel struct {
+	Support float64
+	Weight  func(x float64) float64
+}
+
+// Kernels of the resize algorithms, by algorithm name.
+var Kernels = map[string]Kernel{
+	"nearest": {Support: 0.5, Weight: func(x float64) float64 {
+		if x >= -0.5 && x < 0.5 {
+			return 1
+		}
+		return 0
+	}},
+	"bilinear": {Support: 1, Weight: func(x float64) float64 {
+		return math.Max(0, 1-math.Abs(x))
+	}},
+	"bicubic":  {Support: 2, Weight: cubic},
+	"lanczos2": {Support: 2, Weight: lanczos(2)},
+	"lanczos3": {Support: 3, Weight: lanczos(3)},
+}
+
+// cubic is the Keys cubic convolution with a = -0.5.
+func cubic(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return 1.5*x*x*x - 2.5*x*x + 1
+	case x < 2:
+		return -0.5*x*x*x + 2.5*x*x - 4*x + 2
+	}
+	return 0
+}
+
+func lanczos(a float64) func(float64) float64 {
+	return func(x float64) float64 {
+		if x == 0 {
+			return 1
+		}
+		if math.Abs(x) >= a {
+			return 0
+		}
+		px := math.Pi * x
+		return a * math.Sin(px) * math.Sin(px/a) / (px * px)
+	}
+}
+
+// contribution lists the source pixels an output pixel is computed from.
+type contribution struct {
+	first   int
+	weights []float32
+}
+
+// contributions computes, for each of the dst output pixels along an axis,
+// the weights of the src input pixels, widening the kernel when downscaling.
+func contributions(src int, dst int, kernel Kernel) []contribution {
+	scale := float64(src) / float64(dst)
+	filterScale := math.Max(scale, 1)
+	support := kernel.Support * filterScale
+
+	out := make([]contribution, dst)
+	for i := range out {
+		center := (float64(i)+0.5)*scale - 0.5
+		left := int(math.Ceil(center - support))
+		right := int(math.Floor(center + support))
+		// Never let an output pixel depend on nothing, which happens when
+		// upscaling with a kernel narrower than the gap between pixels.
+		if right < left {
+			right = left
+		}
+
+		weights := make([]float32, right-left+1)
+		var total float64
+		for j := left; j <= right; j++ {
+			w := kernel.Weight((float64(j) - center) / filterScale)
+			weights[j-left] = float32(w)
+			total += w
+		}
+		if total == 0 {
+			weights[min(max(int(math.Round(center))-left, 0), len(weights)-1)] = 1
+			total = 1
+		}
+		for k := range weights {
+			weights[k] /= float32(total)
+		}
+
+		out[i] = contribution{first: left, weights: weights}
+	}
+	return out
+}
+
+// Rows is an image read one row at a time from the top, such as an image being decoded.
+type Rows interface {
+	// Size is the size of the image.
+	Size() image.Point
+	// Next fills dst with the premultiplied RGBA values, from 0 to 255, of the
+	// next row, returning io.EOF past the last one.
+	Next(dst []float32) error
+}
+
+// imageRows reads the rows of a decoded image.
+type imageRows struct {
+	bounds image.Rectangle
+	read   func(y int, dst []float32)
+	y      int
+}
+
+// ImageRows returns the rows of img, read directly from the pixel buffers of the
+// common image types.
+func ImageRows(img image.Image) Rows {
+	return &imageRows{bounds: img.Bounds(), read: rowReader(img)}
+}
+
+func (r *imageRows) Size() image.Point {
+	return r.bounds.Size()
+}
+
+func (r *imageRows) Next(dst []float32) error {
+	if r.y >= r.bounds.Dy() {
+		return io.EOF
+	}
+	r.read(r.bounds.Min.Y+r.y, dst)
+	r.y++
+	return nil
+}
+
+// Resize resamples img to width x height with a separable kernel, producing the
+// output one row at a time. See ResizeRows.
+func Resize(ctx context.Context, img image.Image, width int, height int, kernel Kernel) (*image.RGBA, error) {
+	return ResizeRows(ctx, ImageRows(img), width, height, kernel)
+}
+
+// ResizeRows resamples the image read from src to width x height with a separable
+// kernel, producing the output one row at a time.
+//
+// Only the source rows needed by the current output row are kept, already scaled
+// horizontally, so the working memory grows with the output width and the
+// kernel height instead of the size of the source. Source rows are read once, from
+// the top, which lets src decode the image as it goes.
+//
+// ResizeRows gives up with the error of ctx when it is done, checking it before each output row.
+func ResizeRows(ctx context.Context, src Rows, width int, height int, kernel Kernel) (*image.RGBA, error) {
+	size := src.Size()
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	if size.X <= 0 || size.Y <= 0 || width <= 0 || height <= 0 {
+		return out, nil
+	}
+
+	horizontal := contributions(size.X, width, kernel)
+	vertical := contributions(size.Y, height, kernel)
+
+	srcRow := make([]float32, size.X*4)
+	next := 0
+
+	// rows holds horizontally scaled source rows, by source row index.
+	rows := make(map[int][]float32)
+	var free [][]float32
+	scaledRow := func(y int) ([]float32, error) {
+		y = min(max(y, 0), size.Y-1)
+		if row, ok := rows[y]; ok {
+			return row, nil
+		}
+		if y < next {
+			return nil, fmt.Errorf("source row %d requested after it was released", y)
+		}
+
+		// Rows are requested from the top, those skipped aren't needed by any output row.
+		for ; next <= y; next++ {
+			if err := src.Next(srcRow); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+		}
+
+		var row []float32
+		if len(free) > 0 {
+			row, free = free[len(free)-1], free[:len(free)-1]
+		} else {
+			row = make([]float32, width*4)
+		}
+
+		for x, c := range horizontal {
+			var r, g, b, a float32
+			for k, w := range c.weights {
+				sx := min(max(c.first+k, 0), size.X-1) * 4
+				r += w * srcRow[sx]
+				g += w * srcRow[sx+1]
+				b += w * srcRow[sx+2]
+				a += w * srcRow[sx+3]
+			}
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = r, g, b, a
+		}
+
+		rows[y] = row
+		return row, nil
+	}
+
+	acc := make([]float32, width*4)
+	for y, c := range vertical {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Release the rows no later output row needs, contributions only move down.
+		lowest := min(max(c.first, 0), size.Y-1)
+		for sy, row := range rows {
+			if sy < lowest {
+				free = append(free, row)
+				delete(rows, sy)
+			}
+		}
+
+		clear(acc)
+		for k, w := range c.weights {
+			row, err := scaledRow(c.first + k)
+			if err != nil {
+				return nil, err
+			}
+			for i := range acc {
+				acc[i] += w * row[i]
+			}
+		}
+
+		pix := out.Pix[y*out.Stride : y*out.Stride+width*4]
+		for x := 0; x < width; x++ {
+			a := clamp(acc[x*4+3])
+			pix[x*4+3] = a
+			// Keep the premultiplied invariant despite the kernel overshoot.
+			for ch := 0; ch < 3; ch++ {
+				pix[x*4+ch] = min(clamp(acc[x*4+ch]), a)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// rowReader returns a function filling dst with the premultiplied RGBA values,
+// from 0 to 255, of row y of img.
+func rowReader(img image.Image) func(y int, dst []float32) {
+	bounds := img.Bounds()
+
+	switch src := img.(type) {
+	case *image.RGBA:
+		return func(y int, dst []float32) {
+			start := src.PixOffset(bounds.Min.X, y)
+			for i, v := range src.Pix[start : start+bounds.Dx()*4] {
+				dst[i] = float32(v)
+			}
+		}
+	case *image.NRGBA:
+		return func(y int, dst []float32) {
+			start := src.PixOffset(bounds.Min.X, y)
+			pix := src.Pix[start : start+bounds.Dx()*4]
+			for i := 0; i < len(pix); i += 4 {
+				a := float32(pix[i+3]) / 255
+				dst[i] = float32(pix[i]) * a
+				dst[i+1] = float32(pix[i+1]) * a
+				dst[i+2] = float32(pix[i+2]) * a
+				dst[i+3] = float32(pix[i+3])
+			}
+		}
+	case *image.YCbCr:
+		return func(y int, dst []float32) {
+			for x := 0; x < bounds.Dx(); x++ {
+				yi := src.YOffset(bounds.Min.X+x, y)
+				ci := src.COffset(bounds.Min.X+x, y)
+				r, g, b := color.YCbCrToRGB(src.Y[yi], src.Cb[ci], src.Cr[ci])
+				dst[x*4], dst[x*4+1], dst[x*4+2], dst[x*4+3] = float32(r), float32(g), float32(b), 255
+			}
+		}
+	case *image.Paletted:
+		palette := make([][4]float32, len(src.Palette))
+		for i, c := range src.Palette {
+			r, g, b, a := c.RGBA()
+			palette[i] = [4]float32{float32(r) / 257, float32(g) / 257, float32(b) / 257, float32(a) / 257}
+		}
+		return func(y int, dst []float32) {
+			start := src.PixOffset(bounds.Min.X, y)
+			for x, v := range src.Pix[start : start+bounds.Dx()] {
+				if int(v) < len(palette) {
+					copy(dst[x*4:x*4+4], palette[v][:])
+				} else {
+					clear(dst[x*4 : x*4+4])
+				}
+			}
+		}
+	case *image.Gray:
+		return func(y int, dst []float32) {
+			start := src.PixOffset(bounds.Min.X, y)
+			for x, v := range src.Pix[start : start+bounds.Dx()] {
+				dst[x*4], dst[x*4+1], dst[x*4+2], dst[x*4+3] = float32(v), float32(v), float32(v), 255
+			}
+		}
+	}
+
+	return func(y int, dst []float32) {
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b, a := img.At(bounds.Min.X+x, y).RGBA()
+			dst[x*4] = float32(r) / 257
+			dst[x*4+1] = float32(g) / 257
+			dst[x*4+2] = float32(b) / 257
+			dst[x*4+3] = float32(a) / 257
+		}
+	}
+}
+
+func clamp(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
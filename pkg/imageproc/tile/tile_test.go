@@ -0,0 +1,150 @@
+package tile
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+func checkerboard(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: uint8(x * 9), G: uint8(y * 9), B: 200, A: 255}
+			if (x+y)%2 == 0 {
+				c.A = 128
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// truncatedRows stops after rows rows of the image.
+type truncatedRows struct {
+	Rows
+	rows int
+}
+
+func (r *truncatedRows) Next(dst []float32) error {
+	if r.rows == 0 {
+		return io.EOF
+	}
+	r.rows--
+	return r.Rows.Next(dst)
+}
+
+func TestResizeSizes(t *testing.T) {
+	src := checkerboard(30, 20)
+
+	tests := []struct {
+		name          string
+		width, height int
+	}{
+		{"downscale", 10, 7},
+		{"upscale", 75, 50},
+		{"stretch", 60, 5},
+		{"single pixel", 1, 1},
+	}
+
+	for _, tt := range tests {
+		for name, kernel := range Kernels {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				out, err := Resize(context.Background(), src, tt.width, tt.height, kernel)
+				if err != nil {
+					t.Fatalf("Resize() error = %v", err)
+				}
+				if size := out.Bounds().Size(); size != image.Pt(tt.width, tt.height) {
+					t.Fatalf("Resize() size = %v, want %dx%d", size, tt.width, tt.height)
+				}
+				// Color channels never exceed alpha in premultiplied pixels.
+				for i := 0; i < len(out.Pix); i += 4 {
+					if a := out.Pix[i+3]; out.Pix[i] > a || out.Pix[i+1] > a || out.Pix[i+2] > a {
+						t.Fatalf("pixel %d is not premultiplied: %v", i/4, out.Pix[i:i+4])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestResizeIdentity(t *testing.T) {
+	src := checkerboard(16, 12)
+
+	opaque := image.NewRGBA(src.Bounds())
+	gray := image.NewGray(src.Bounds())
+	paletted := image.NewPaletted(src.Bounds(), color.Palette{color.Black, color.RGBA{R: 200, G: 100, A: 255}, color.Transparent})
+	// RGBA64 images have no fast path and are read pixel by pixel.
+	generic := image.NewRGBA64(src.Bounds())
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 16; x++ {
+			opaque.Set(x, y, color.RGBA{R: uint8(x * 15), G: uint8(y * 20), B: 7, A: 255})
+			gray.SetGray(x, y, color.Gray{Y: uint8(x*y + 3)})
+			paletted.SetColorIndex(x, y, uint8((x+y)%3))
+			generic.Set(x, y, color.RGBA{R: uint8(y * 20), G: uint8(x * 15), B: 90, A: 255})
+		}
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"nrgba", src},
+		{"rgba", opaque},
+		{"gray", gray},
+		{"paletted", paletted},
+		{"generic", generic},
+		{"sub-image", src.SubImage(image.Rect(3, 2, 13, 10))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bounds := tt.img.Bounds()
+			out, err := Resize(context.Background(), tt.img, bounds.Dx(), bounds.Dy(), Kernels["nearest"])
+			if err != nil {
+				t.Fatalf("Resize() error = %v", err)
+			}
+			for y := 0; y < bounds.Dy(); y++ {
+				for x := 0; x < bounds.Dx(); x++ {
+					want := color.RGBAModel.Convert(tt.img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+					// Premultiplying rounds where the image package truncates.
+					if got := out.RGBAAt(x, y); !closeColors(got, want) {
+						t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestResizeRowsErrors(t *testing.T) {
+	src := checkerboard(20, 20)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		rows Rows
+		want error
+	}{
+		{"truncated source", context.Background(), &truncatedRows{Rows: ImageRows(src), rows: 10}, io.ErrUnexpectedEOF},
+		{"cancelled", cancelled, ImageRows(src), context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ResizeRows(tt.ctx, tt.rows, 10, 10, Kernels["lanczos3"]); !errors.Is(err, tt.want) {
+				t.Errorf("ResizeRows() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func closeColors(a color.RGBA, b color.RGBA) bool {
+	near := func(x, y uint8) bool { return x-y <= 1 || y-x <= 1 }
+	return near(a.R, b.R) && near(a.G, b.G) && near(a.B, b.B) && a.A == b.A
+}
@@ -0,0 +1,144 @@
+package trim
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// MaxTolerance is the largest per channel difference accepted as a tolerance.
+const MaxTolerance = 255
+
+// Validate checks the trim tolerance and padding of a request.
+func Validate(tolerance int, padding int) error {
+	if tolerance < 0 || tolerance > MaxTolerance {
+		return fmt.Errorf("trim tolerance must be between 0 and %d", MaxTolerance)
+	}
+	if padding < 0 {
+		return fmt.Errorf("trim padding must not be negative")
+	}
+	return nil
+}
+
+// Window returns the part of img left once its uniform border is removed,
+// grown by padding pixels on each side without leaving the image.
+//
+// The border is either transparent, when most corners are transparent, or the color
+// shared by most corners. Pixels are part of the border when none of their channels
+// differs from the border by more than tolerance (0 to 255). Images without a clear
+// border color, or made only of border, are returned whole.
+func Window(img image.Image, tolerance int, padding int) image.Rectangle {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return bounds
+	}
+
+	isBorder, ok := borderMatcher(img, tolerance)
+	if !ok {
+		return bounds
+	}
+
+	rowIsBorder := func(y int) bool {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !isBorder(img.At(x, y)) {
+				return false
+			}
+		}
+		return true
+	}
+	columnIsBorder := func(x int, minY int, maxY int) bool {
+		for y := minY; y < maxY; y++ {
+			if !isBorder(img.At(x, y)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	top := bounds.Min.Y
+	for top < bounds.Max.Y && rowIsBorder(top) {
+		top++
+	}
+	if top == bounds.Max.Y {
+		return bounds
+	}
+
+	bottom := bounds.Max.Y
+	for bottom > top && rowIsBorder(bottom-1) {
+		bottom--
+	}
+
+	left := bounds.Min.X
+	for left < bounds.Max.X && columnIsBorder(left, top, bottom) {
+		left++
+	}
+
+	right := bounds.Max.X
+	for right > left && columnIsBorder(right-1, top, bottom) {
+		right--
+	}
+
+	return image.Rect(left-padding, top-padding, right+padding, bottom+padding).Intersect(bounds)
+}
+
+// borderMatcher picks the border of img from its corners and returns a function
+// telling whether a color belongs to it. It returns false when the corners
+// don't agree on a border.
+func borderMatcher(img image.Image, tolerance int) (func(color.Color) bool, bool) {
+	bounds := img.Bounds()
+	corners := [4]color.NRGBA{}
+	for i, p := range []image.Point{
+		bounds.Min,
+		{X: bounds.Max.X - 1, Y: bounds.Min.Y},
+		{X: bounds.Min.X, Y: bounds.Max.Y - 1},
+		bounds.Max.Sub(image.Pt(1, 1)),
+	} {
+		corners[i] = color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA)
+	}
+
+	transparent := func(c color.NRGBA) bool {
+		return int(c.A) <= tolerance
+	}
+
+	transparentCorners := 0
+	for _, c := range corners {
+		if transparent(c) {
+			transparentCorners++
+		}
+	}
+	if transparentCorners >= 3 {
+		return func(c color.Color) bool {
+			return transparent(color.NRGBAModel.Convert(c).(color.NRGBA))
+		}, true
+	}
+
+	for _, candidate := range corners {
+		matches := 0
+		for _, c := range corners {
+			if similar(candidate, c, tolerance) {
+				matches++
+			}
+		}
+		if matches >= 3 {
+			return func(c color.Color) bool {
+				return similar(candidate, color.NRGBAModel.Convert(c).(color.NRGBA), tolerance)
+			}, true
+		}
+	}
+
+	return nil, false
+}
+
+func similar(a color.NRGBA, b color.NRGBA, tolerance int) bool {
+	return abs(int(a.R)-int(b.R)) <= tolerance &&
+		abs(int(a.G)-int(b.G)) <= tolerance &&
+		abs(int(a.B)-int(b.B)) <= tolerance &&
+		abs(int(a.A)-int(b.A)) <= tolerance
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
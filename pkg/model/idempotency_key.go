@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// IdempotencyKey binds a key sent with a job submission to the job it created.
+type IdempotencyKey struct {
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint"`
+	JobID       string    `json:"job_id"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	// Pending is set until the submission holding the key has created its job.
+	Pending bool `json:"pending"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// ImageHashes holds the perceptual hashes of an image.
+// They are serialized as strings since 64 bit integers
+// don't fit in a JavaScript number.
+type ImageHashes struct {
+	AHash uint64 `json:"ahash,string"`
+	DHash uint64 `json:"dhash,string"`
+	PHash uint64 `json:"phash,string"`
+}
+
+// ImageHashRecord is the stored hashes of one input image of a job.
+type ImageHashRecord struct {
+	JobID      string      `json:"job_id"`
+	ImageIndex int         `json:"image_index"`
+	ImageURL   string      `json:"image_url"`
+	Hashes     ImageHashes `json:"hashes"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// DuplicateMatch is a previous image found close to a searched one.
+type DuplicateMatch struct {
+	JobID      string `json:"job_id"`
+	ImageIndex int    `json:"image_index"`
+	ImageURL   string `json:"image_url"`
+	Distance   int    `json:"distance"`
+}
@@ -0,0 +1,11 @@
+package model
+
+// JobEvent is a change of the status or of the progress of a job,
+// as notified by the database on the resize_job_events channel.
+type JobEvent struct {
+	JobID     string       `json:"job_id"`
+	OwnerID   int          `json:"owner_id"`
+	Status    string       `json:"status"`
+	Progress  *JobProgress `json:"progress,omitempty"`
+	ErrorCode string       `json:"errorCode,omitempty"`
+}
@@ -1,12 +1,180 @@
 package model
 
+import "time"
+
 type ResizeJob struct {
-	Id           int      `json:"id"`
-	Images       []string `json:"images"`
-	Algorithm    string   `json:"algorithm"`
-	TargetWidth  int      `json:"targetWidth"`
-	TargetHeight int      `json:"targetHeight"`
-	JobID        string   `json:"job_id"`
-	Status       string   `json:"status"`
-	OwnerID      int      `json:"owner_Id"`
+	Id           int              `json:"id"`
+	Images       []string         `json:"images"`
+	Algorithm    string           `json:"algorithm"`
+	TargetWidth  int              `json:"targetWidth"`
+	TargetHeight int              `json:"targetHeight"`
+	Mode         string           `json:"mode"`
+	Widths       []int            `json:"widths,omitempty"`
+	Preset       string           `json:"preset,omitempty"`
+	Algorithms   []string         `json:"algorithms,omitempty"`
+	PaletteSize  int              `json:"paletteSize,omitempty"`
+	Fit          string           `json:"fit,omitempty"`
+	Gravity      string           `json:"gravity,omitempty"`
+	ProtectMask  string           `json:"protectMask,omitempty"`
+	RemoveMask   string           `json:"removeMask,omitempty"`
+	Trim         *TrimOptions     `json:"trim,omitempty"`
+	Redactions   []Redaction      `json:"redactions,omitempty"`
+	OutputFormat string           `json:"outputFormat,omitempty"`
+	Quantize     *QuantizeOptions `json:"quantize,omitempty"`
+	Priority     uint8            `json:"priority,omitempty"`
+	CallbackURL  string           `json:"callbackUrl,omitempty"`
+	JobID        string           `json:"job_id"`
+	Status       string           `json:"status"`
+	OwnerID      int              `json:"owner_Id"`
+	Results      []ImageResult    `json:"results"`
+
+	// Progress is recorded by the worker as the images of the job are processed.
+	Progress *JobProgress `json:"progress,omitempty"`
+
+	// ErrorCode and Error describe why a job failed as a whole.
+	ErrorCode string `json:"errorCode,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// JobProgress tells how far the processing of a job went. Processed counts the
+// images done, failed ones included, and Current is the index of the image being
+// processed. ETASeconds, estimated from the throughput so far, is unknown until
+// the first image is done.
+type JobProgress struct {
+	Total      int       `json:"total"`
+	Processed  int       `json:"processed"`
+	Failed     int       `json:"failed"`
+	Current    int       `json:"current"`
+	ETASeconds *float64  `json:"etaSeconds,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// ScheduledJob is a job held until RunAt before it is queued.
+type ScheduledJob struct {
+	JobID     string    `json:"job_id"`
+	RunAt     time.Time `json:"runAt"`
+	Mode      string    `json:"mode"`
+	Algorithm string    `json:"algorithm"`
+	Images    int       `json:"images"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ImageResult describes what was produced for one input image of a job.
+type ImageResult struct {
+	Index  int    `json:"index"`
+	URL    string `json:"url,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Bytes  int    `json:"bytes,omitempty"`
+
+	// Variants and Srcset are only filled by responsive jobs.
+	Variants []ImageVariant `json:"variants,omitempty"`
+	Srcset   string         `json:"srcset,omitempty"`
+
+	// Comparisons are only filled by compare jobs, one per algorithm.
+	Comparisons []AlgorithmComparison `json:"comparisons,omitempty"`
+
+	// BlurHash and LQIP are placeholders of the output to show while it loads.
+	// LQIP is a tiny JPEG as a data URI.
+	BlurHash string `json:"blurhash,omitempty"`
+	LQIP     string `json:"lqip,omitempty"`
+
+	// Palette holds the dominant colors of the image, most common first.
+	Palette []PaletteColor `json:"palette,omitempty"`
+
+	// Hashes are computed on the input image, before resizing.
+	Hashes *ImageHashes `json:"hashes,omitempty"`
+
+	// Trim is the window of the input left once its uniform border is trimmed.
+	Trim *Box `json:"trim,omitempty"`
+
+	// Crop is the window of the input kept by cover and crop fits.
+	Crop *Box `json:"crop,omitempty"`
+
+	// Error tells why the image failed, ErrorCode is set when the input was rejected.
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+// TrimOptions enables the removal of the uniform border of the inputs of a job.
+// Tolerance is the largest difference, per channel from 0 to 255, between a border
+// pixel and the border color. Padding is the number of border pixels kept on each side.
+type TrimOptions struct {
+	Tolerance int `json:"tolerance"`
+	Padding   int `json:"padding"`
+}
+
+// QuantizeOptions reduces the colors of the outputs of a job. The palette is either
+// the named fixed Palette or Colors colors generated with Algorithm, and the
+// pixels are mapped to it with the Dither method.
+type QuantizeOptions struct {
+	Colors    int    `json:"colors,omitempty"`
+	Palette   string `json:"palette,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Dither    string `json:"dither,omitempty"`
+}
+
+// Redaction is a region of an input image hidden before any processing.
+// The region is either the rectangle X, Y, Width, Height or a Polygon, in pixels
+// or, when Relative is set, in fractions of the image size.
+type Redaction struct {
+	X        float64 `json:"x,omitempty"`
+	Y        float64 `json:"y,omitempty"`
+	Width    float64 `json:"width,omitempty"`
+	Height   float64 `json:"height,omitempty"`
+	Polygon  []Point `json:"polygon,omitempty"`
+	Relative bool    `json:"relative,omitempty"`
+
+	// Method is "pixelate" (default), "blur" or "fill".
+	Method string `json:"method,omitempty"`
+	// Strength is the pixelation block size or the blur standard deviation, in pixels.
+	Strength int `json:"strength,omitempty"`
+	// Color is the "#rrggbb" fill color, black by default.
+	Color string `json:"color,omitempty"`
+}
+
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Box is a rectangle in pixel coordinates of an input image.
+type Box struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// ImageVariant is one of the widths generated for an image by a responsive job.
+type ImageVariant struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int    `json:"bytes"`
+	URL    string `json:"url"`
+}
+
+// AlgorithmComparison reports how one resize algorithm performed on an image.
+// Quality metrics compare the original image with the resized output scaled
+// back to the original size by the same algorithm.
+type AlgorithmComparison struct {
+	Algorithm string  `json:"algorithm"`
+	URL       string  `json:"url"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Bytes     int     `json:"bytes"`
+	ResizeMs  float64 `json:"resizeMs"`
+	EncodeMs  float64 `json:"encodeMs"`
+	PSNR      float64 `json:"psnr"`
+	SSIM      float64 `json:"ssim"`
+	MSSSIM    float64 `json:"msssim"`
+}
+
+// PaletteColor is one of the dominant colors of an image.
+type PaletteColor struct {
+	Hex        string  `json:"hex"`
+	R          uint8   `json:"r"`
+	G          uint8   `json:"g"`
+	B          uint8   `json:"b"`
+	Proportion float64 `json:"proportion"`
 }
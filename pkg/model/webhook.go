@@ -0,0 +1,25 @@
+package model
+
+import "encoding/json"
+
+// WebhookDelivery is the notification of a finished job to its callback URL.
+type WebhookDelivery struct {
+	ID       int             `json:"id"`
+	JobID    string          `json:"job_id"`
+	OwnerID  int             `json:"owner_id"`
+	URL      string          `json:"url"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	// AttemptsBase is the number of attempts made before the latest redelivery.
+	AttemptsBase int `json:"attemptsBase"`
+	// Secret is the webhook secret of the owner, which signs the delivery.
+	Secret string `json:"-"`
+}
+
+// WebhookAttempt is one try of a delivery. StatusCode is 0 when no response was received.
+type WebhookAttempt struct {
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int    `json:"durationMs"`
+}
@@ -0,0 +1,55 @@
+package mq
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed is returned by the operations of a closed broker.
+var ErrClosed = errors.New("broker is closed")
+
+// ErrUnconfirmed is returned when a message was sent but the broker didn't tell
+// whether it took it. The message may still be delivered.
+var ErrUnconfirmed = errors.New("message outcome unknown")
+
+// Message is published to a queue of a broker.
+type Message struct {
+	ContentType string
+	Body        []byte
+	// Priority orders the messages waiting in the queue, up to MaxPriority.
+	Priority uint8
+}
+
+// Delivery is a message handed to a consumer. The broker keeps it until it is
+// acknowledged, a delivery neither acked nor nacked is delivered again when the
+// connection of its consumer is lost.
+type Delivery struct {
+	Message
+	ack  func() error
+	nack func(requeue bool) error
+}
+
+// Ack tells the broker the delivery was handled.
+func (d Delivery) Ack() error {
+	return d.ack()
+}
+
+// Nack tells the broker the delivery wasn't handled. It is queued again when
+// requeue is set, dropped otherwise.
+func (d Delivery) Nack(requeue bool) error {
+	return d.nack(requeue)
+}
+
+// Broker queues messages between the API and the workers.
+type Broker interface {
+	// Publish queues msg on queue. It fails with ErrUnconfirmed when msg may
+	// have been queued anyway.
+	Publish(ctx context.Context, queue string, msg Message) error
+	// Consume returns the deliveries of queue until ctx is done or the broker is
+	// closed, with at most prefetch of them not acknowledged at a time.
+	Consume(ctx context.Context, queue string, prefetch int) (<-chan Delivery, error)
+	// Health returns nil while the broker can be used, otherwise why it can't.
+	Health() error
+	// Close releases the broker, pending deliveries are left to the broker.
+	Close() error
+}
@@ -0,0 +1,210 @@
+package mq
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+)
+
+var errSettled = errors.New("delivery already acknowledged")
+
+// Memory is a Broker holding its queues in memory. Messages are delivered by
+// priority, then in publishing order, and are lost when the process exits. It
+// only links the publishers and consumers of one process, as in tests.
+type Memory struct {
+	mu        sync.Mutex
+	queues    map[string]*memoryQueue
+	seq       uint64
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemory returns an empty in-memory broker.
+func NewMemory() *Memory {
+	return &Memory{
+		queues: make(map[string]*memoryQueue),
+		closed: make(chan struct{}),
+	}
+}
+
+type memoryMessage struct {
+	Message
+	seq uint64
+}
+
+// memoryQueue is a heap of messages, the highest priority first.
+type memoryQueue struct {
+	messages []memoryMessage
+	// ready wakes up a waiting consumer when messages are queued.
+	ready chan struct{}
+}
+
+func (q *memoryQueue) Len() int { return len(q.messages) }
+
+func (q *memoryQueue) Less(i, j int) bool {
+	if q.messages[i].Priority != q.messages[j].Priority {
+		return q.messages[i].Priority > q.messages[j].Priority
+	}
+	return q.messages[i].seq < q.messages[j].seq
+}
+
+func (q *memoryQueue) Swap(i, j int) { q.messages[i], q.messages[j] = q.messages[j], q.messages[i] }
+
+func (q *memoryQueue) Push(x any) { q.messages = append(q.messages, x.(memoryMessage)) }
+
+func (q *memoryQueue) Pop() any {
+	last := q.messages[len(q.messages)-1]
+	q.messages = q.messages[:len(q.messages)-1]
+	return last
+}
+
+func (q *memoryQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// queue returns the queue called name, creating it on first use. m.mu must be held.
+func (m *Memory) queue(name string) *memoryQueue {
+	q, ok := m.queues[name]
+	if !ok {
+		q = &memoryQueue{ready: make(chan struct{}, 1)}
+		m.queues[name] = q
+	}
+	return q
+}
+
+func (m *Memory) push(name string, msg memoryMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q := m.queue(name)
+	heap.Push(q, msg)
+	q.signal()
+}
+
+// next waits for the next message of the queue called name.
+func (m *Memory) next(ctx context.Context, name string) (memoryMessage, bool) {
+	for {
+		m.mu.Lock()
+		q := m.queue(name)
+		if q.Len() > 0 {
+			msg := heap.Pop(q).(memoryMessage)
+			// Another consumer may be waiting for the rest.
+			if q.Len() > 0 {
+				q.signal()
+			}
+			m.mu.Unlock()
+			return msg, true
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return memoryMessage{}, false
+		case <-m.closed:
+			return memoryMessage{}, false
+		}
+	}
+}
+
+// Publish queues msg on queue.
+func (m *Memory) Publish(ctx context.Context, queue string, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-m.closed:
+		return ErrClosed
+	default:
+	}
+
+	m.mu.Lock()
+	m.seq++
+	seq := m.seq
+	m.mu.Unlock()
+
+	m.push(queue, memoryMessage{Message: msg, seq: seq})
+	return nil
+}
+
+// Consume hands out the messages of queue, up to prefetch of them until they are
+// settled. Once ctx is done the deliveries handed out can still be settled, as
+// with a cancelled RabbitMQ consumer.
+func (m *Memory) Consume(ctx context.Context, queue string, prefetch int) (<-chan Delivery, error) {
+	select {
+	case <-m.closed:
+		return nil, ErrClosed
+	default:
+	}
+
+	deliveries := make(chan Delivery)
+	go func() {
+		defer close(deliveries)
+
+		// slots holds a value for each delivery not settled yet.
+		slots := make(chan struct{}, max(prefetch, 1))
+		for {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			case <-m.closed:
+				return
+			}
+
+			msg, ok := m.next(ctx, queue)
+			if !ok {
+				return
+			}
+
+			var once sync.Once
+			settle := func(requeue bool) error {
+				err := errSettled
+				once.Do(func() {
+					if requeue {
+						m.push(queue, msg)
+					}
+					<-slots
+					err = nil
+				})
+				return err
+			}
+			delivery := Delivery{
+				Message: msg.Message,
+				ack:     func() error { return settle(false) },
+				nack:    settle,
+			}
+
+			select {
+			case deliveries <- delivery:
+			case <-ctx.Done():
+				settle(true)
+				return
+			case <-m.closed:
+				return
+			}
+		}
+	}()
+
+	return deliveries, nil
+}
+
+// Health returns ErrClosed once the broker is closed.
+func (m *Memory) Health() error {
+	select {
+	case <-m.closed:
+		return ErrClosed
+	default:
+		return nil
+	}
+}
+
+// Close stops the consumers, the queued messages are dropped.
+func (m *Memory) Close() error {
+	m.closeOnce.Do(func() { close(m.closed) })
+	return nil
+}
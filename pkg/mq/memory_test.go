@@ -0,0 +1,199 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testQueue = "test"
+
+func publish(t *testing.T, b Broker, body string, priority uint8) {
+	t.Helper()
+	if err := b.Publish(context.Background(), testQueue, Message{Body: []byte(body), Priority: priority}); err != nil {
+		t.Fatalf("Publish(%s) failed: %v", body, err)
+	}
+}
+
+func receive(t *testing.T, deliveries <-chan Delivery) Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-deliveries:
+		if !ok {
+			t.Fatal("deliveries closed")
+		}
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+	}
+	return Delivery{}
+}
+
+func expectNone(t *testing.T, deliveries <-chan Delivery) {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		t.Fatalf("unexpected delivery %s", d.Body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryDeliveryOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities []uint8
+		want       []string
+	}{
+		{"same priority in publishing order", []uint8{0, 0, 0}, []string{"0", "1", "2"}},
+		{"highest priority first", []uint8{1, 9, 5}, []string{"1", "2", "0"}},
+		{"ties in publishing order", []uint8{5, 9, 5, 9}, []string{"1", "3", "0", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemory()
+			defer b.Close()
+			for i, p := range tt.priorities {
+				publish(t, b, string(rune('0'+i)), p)
+			}
+
+			deliveries, err := b.Consume(context.Background(), testQueue, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				d := receive(t, deliveries)
+				if string(d.Body) != want {
+					t.Fatalf("got %s, want %s", d.Body, want)
+				}
+				if err := d.Ack(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expectNone(t, deliveries)
+		})
+	}
+}
+
+func TestMemoryPrefetch(t *testing.T) {
+	b := NewMemory()
+	defer b.Close()
+	for _, body := range []string{"a", "b", "c"} {
+		publish(t, b, body, 0)
+	}
+
+	deliveries, err := b.Consume(context.Background(), testQueue, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := receive(t, deliveries)
+	receive(t, deliveries)
+	// Both deliveries are unsettled, the third one waits.
+	expectNone(t, deliveries)
+
+	if err := first.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if d := receive(t, deliveries); string(d.Body) != "c" {
+		t.Fatalf("got %s, want c", d.Body)
+	}
+}
+
+func TestMemorySettle(t *testing.T) {
+	tests := []struct {
+		name        string
+		settle      func(Delivery) error
+		redelivered bool
+	}{
+		{"ack", Delivery.Ack, false},
+		{"nack and requeue", func(d Delivery) error { return d.Nack(true) }, true},
+		{"nack and drop", func(d Delivery) error { return d.Nack(false) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemory()
+			defer b.Close()
+			publish(t, b, "job", 0)
+
+			deliveries, err := b.Consume(context.Background(), testQueue, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := receive(t, deliveries)
+			if err := tt.settle(d); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Ack(); !errors.Is(err, errSettled) {
+				t.Fatalf("second settlement returned %v, want %v", err, errSettled)
+			}
+
+			if tt.redelivered {
+				if d := receive(t, deliveries); string(d.Body) != "job" {
+					t.Fatalf("got %s, want job", d.Body)
+				}
+				return
+			}
+			expectNone(t, deliveries)
+		})
+	}
+}
+
+func TestMemoryRequeueOnConsumerStop(t *testing.T) {
+	b := NewMemory()
+	defer b.Close()
+	publish(t, b, "a", 0)
+	publish(t, b, "b", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deliveries, err := b.Consume(ctx, testQueue, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := receive(t, deliveries)
+	// The consumer already took "b" and waits to hand it out.
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	for range deliveries {
+	}
+
+	// The delivery handed out can still be settled after the consumer stopped.
+	if err := pending.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err = b.Consume(context.Background(), testQueue, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := receive(t, deliveries); string(d.Body) != "b" {
+		t.Fatalf("got %s, want b", d.Body)
+	}
+	expectNone(t, deliveries)
+}
+
+func TestMemoryClose(t *testing.T) {
+	b := NewMemory()
+	deliveries, err := b.Consume(context.Background(), testQueue, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Health(); err != nil {
+		t.Fatalf("Health() = %v before Close", err)
+	}
+
+	b.Close()
+	if _, ok := <-deliveries; ok {
+		t.Fatal("deliveries not closed")
+	}
+	if err := b.Health(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Health() = %v, want %v", err, ErrClosed)
+	}
+	if err := b.Publish(context.Background(), testQueue, Message{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Publish() = %v, want %v", err, ErrClosed)
+	}
+	if _, err := b.Consume(context.Background(), testQueue, 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Consume() = %v, want %v", err, ErrClosed)
+	}
+}
@@ -1,72 +1,69 @@
 package mq
 
 import (
+	"errors"
 	"os"
 
 	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
 	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
-	"github.com/streadway/amqp"
 )
 
-var rabbitConn *amqp.Connection
-var publishChannel *amqp.Channel
-var consumeChannel *amqp.Channel
-
-func init() {
-	var err error
-	rabbitConn, err = amqp.Dial(os.Getenv("RABBITMQ_URL"))
-	if err != nil {
-		logger.Log.Fatalf("Failed to connect to RabbitMQ: %v", err)
-	}
-
-	// Separate channel for publishing
-	publishChannel, err = rabbitConn.Channel()
-	if err != nil {
-		logger.Log.Fatalf("Failed to open publish channel: %v", err)
-	}
+// Brokers selected by MQ_BROKER, see InitBroker.
+const (
+	BrokerRabbitMQ = "rabbitmq"
+	BrokerMemory   = "memory"
+)
 
-	// Separate channel for consuming
-	consumeChannel, err = rabbitConn.Channel()
-	if err != nil {
-		logger.Log.Fatalf("Failed to open consume channel: %v", err)
-	}
+var broker Broker
 
-	// Declare the queue at startup
-	_, err = publishChannel.QueueDeclare(
-		"image_resize", // queue name
-		true,           // durable
-		false,          // delete when unused
-		false,          // exclusive
-		false,          // no-wait
-		nil,            // arguments
-	)
-	if err != nil {
-		logger.Log.Fatalf("Failed to declare queue: %v", err)
+// InitBroker sets up the broker selected by MQ_BROKER, RabbitMQ being the only
+// one. The memory broker only links the publishers and consumers of a single
+// process, while the API and the workers run apart: jobs published by the API
+// would never reach a worker. It is refused here and only set up with SetBroker,
+// in tests.
+func InitBroker() {
+	switch kind := os.Getenv("MQ_BROKER"); kind {
+	case "", BrokerRabbitMQ:
+		rabbit, err := NewRabbitMQ(ConfigFromEnv())
+		if err != nil {
+			logger.Log.Fatalf("Failed to set up RabbitMQ: %v", err)
+		}
+		broker = rabbit
+	case BrokerMemory:
+		logger.Log.Fatalf("MQ_BROKER %q can't link the API and the workers, which run as separate processes", kind)
+	default:
+		logger.Log.Fatalf("Unknown MQ_BROKER %q", kind)
 	}
-
-	logger.Log.Println("Queue 'image_resize' declared successfully")
 }
 
-func GetPublishChannel() *amqp.Channel {
-	return publishChannel
+// SetBroker replaces the broker used by the package, for tests.
+func SetBroker(b Broker) {
+	broker = b
 }
 
-func GetConsumeChannel() *amqp.Channel {
-	return consumeChannel
+// GetBroker returns the broker set up by InitBroker.
+func GetBroker() Broker {
+	return broker
 }
 
-func CloseRabbitMQ() {
-	logger.Log.Info("Closing RabbitMQ connection...")
-
-	if publishChannel != nil {
-		publishChannel.Close()
-	}
-	if consumeChannel != nil {
-		consumeChannel.Close()
+// Health reports whether the broker can be used, see Broker.
+func Health() error {
+	if broker == nil {
+		return errors.New("message broker not initialized")
 	}
-	if rabbitConn != nil {
-		rabbitConn.Close()
+	return broker.Health()
+}
+
+// CloseBroker closes the broker, if one was set up.
+func CloseBroker() {
+	if broker == nil {
+		return
 	}
 
-	logger.Log.Info("RabbitMQ connection closed")
+	logger.Log.Info("Closing message broker...")
+	if err := broker.Close(); err != nil {
+		logger.Log.Warnf("Failed to close message broker: %v", err)
+		return
+	}
+	logger.Log.Info("Message broker closed")
 }
@@ -0,0 +1,67 @@
+package mq
+
+import (
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// MaxPriority is the x-max-priority of ResizeQueue.
+// Messages with a higher priority are delivered first.
+const MaxPriority = 9
+
+// Priorities requested by clients.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// TierPro is the paid tier of users, whose jobs get a higher priority.
+const TierPro = "pro"
+
+// ValidPriority reports whether priority can be requested, "" meaning normal.
+func ValidPriority(priority string) bool {
+	switch priority {
+	case "", PriorityLow, PriorityNormal, PriorityHigh:
+		return true
+	}
+	return false
+}
+
+// JobPriority returns the message priority of a job. Small jobs, typically a single
+// image from the web UI, come first and large batches last. A requested "low" priority
+// sends the job behind every batch, "high" and the pro tier move it up.
+func JobPriority(job model.ResizeJob, requested string, tier string) uint8 {
+	if requested == PriorityLow {
+		return 0
+	}
+
+	// Each output of each image is about one unit of work.
+	outputs := 1
+	switch {
+	case len(job.Widths) > 0:
+		outputs = len(job.Widths)
+	case len(job.Algorithms) > 0:
+		outputs = len(job.Algorithms)
+	}
+
+	var priority int
+	switch cost := len(job.Images) * outputs; {
+	case cost <= 1:
+		priority = 6
+	case cost <= 10:
+		priority = 4
+	case cost <= 100:
+		priority = 2
+	default:
+		priority = 1
+	}
+
+	if requested == PriorityHigh {
+		priority += 2
+	}
+	if tier == TierPro {
+		priority++
+	}
+
+	return uint8(min(priority, MaxPriority))
+}
@@ -0,0 +1,62 @@
+package mq
+
+import (
+	"testing"
+
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+func TestJobPriority(t *testing.T) {
+	images := func(n int) []string { return make([]string, n) }
+
+	tests := []struct {
+		name      string
+		job       model.ResizeJob
+		requested string
+		tier      string
+		want      uint8
+	}{
+		{"single image", model.ResizeJob{Images: images(1)}, "", "", 6},
+		{"small batch", model.ResizeJob{Images: images(10)}, PriorityNormal, "", 4},
+		{"batch", model.ResizeJob{Images: images(11)}, "", "", 2},
+		{"large batch", model.ResizeJob{Images: images(101)}, "", "", 1},
+		{"responsive widths count as outputs", model.ResizeJob{Images: images(3), Widths: []int{320, 640, 960, 1280}}, "", "", 2},
+		{"compared algorithms count as outputs", model.ResizeJob{Images: images(1), Algorithms: []string{"bilinear", "lanczos3"}}, "", "", 4},
+		{"no images", model.ResizeJob{}, "", "", 6},
+		{"requested high", model.ResizeJob{Images: images(50)}, PriorityHigh, "", 4},
+		{"pro tier", model.ResizeJob{Images: images(50)}, "", TierPro, 3},
+		{"requested high on the pro tier", model.ResizeJob{Images: images(1)}, PriorityHigh, TierPro, MaxPriority},
+		{"requested low", model.ResizeJob{Images: images(1)}, PriorityLow, "", 0},
+		{"requested low on the pro tier", model.ResizeJob{Images: images(1)}, PriorityLow, TierPro, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JobPriority(tt.job, tt.requested, tt.tier); got != tt.want {
+				t.Errorf("JobPriority() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidPriority(t *testing.T) {
+	tests := []struct {
+		priority string
+		want     bool
+	}{
+		{"", true},
+		{PriorityLow, true},
+		{PriorityNormal, true},
+		{PriorityHigh, true},
+		{"urgent", false},
+		{"HIGH", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.priority, func(t *testing.T) {
+			if got := ValidPriority(tt.priority); got != tt.want {
+				t.Errorf("ValidPriority(%q) = %v, want %v", tt.priority, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,582 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	"github.com/streadway/amqp"
+)
+
+// ErrNotConnected is returned while the connection to RabbitMQ is being re-established.
+var ErrNotConnected = errors.New("not connected to RabbitMQ")
+
+// ErrNotAccepted is returned when RabbitMQ doesn't take responsibility for a
+// published message: it rejected it or couldn't route it to a queue.
+var ErrNotAccepted = errors.New("message not accepted by RabbitMQ")
+
+const (
+	defaultConfirmTimeout = 5 * time.Second
+	// confirmBuffer is the number of confirmations and returns of messages whose
+	// publisher stopped waiting that may pile up before the connection blocks.
+	confirmBuffer = 64
+
+	// The first reconnection waits minReconnectDelay, each next one twice as long
+	// up to maxReconnectDelay.
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Queue is a durable queue declared by RabbitMQ when it connects.
+type Queue struct {
+	Name string
+	// MaxPriority is the x-max-priority of the queue, 0 for a queue without priorities.
+	MaxPriority uint8
+	// Previous is the queue that held the messages before this one, if any. Its
+	// messages are moved to this queue when connecting, then it is deleted.
+	Previous string
+}
+
+// Config of a RabbitMQ broker.
+type Config struct {
+	URL    string
+	Queues []Queue
+	// ConfirmTimeout bounds the wait for the server to confirm a published message.
+	ConfirmTimeout time.Duration
+}
+
+// ConfigFromEnv returns the config of the broker of the jobs, from RABBITMQ_URL
+// and PUBLISH_CONFIRM_TIMEOUT as a Go duration.
+func ConfigFromEnv() Config {
+	confirmTimeout, err := time.ParseDuration(os.Getenv("PUBLISH_CONFIRM_TIMEOUT"))
+	if err != nil || confirmTimeout <= 0 {
+		confirmTimeout = defaultConfirmTimeout
+	}
+
+	return Config{
+		URL:            os.Getenv("RABBITMQ_URL"),
+		Queues:         []Queue{{Name: ResizeQueue, MaxPriority: MaxPriority, Previous: legacyResizeQueue}},
+		ConfirmTimeout: confirmTimeout,
+	}
+}
+
+// publisher is the publish channel of a connection, in confirm mode.
+type publisher struct {
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+	// seq is the delivery tag of the last published message.
+	seq uint64
+}
+
+// RabbitMQ is a Broker backed by a RabbitMQ server, publishing and consuming
+// on separate channels of a single connection.
+//
+// When the connection or one of its channels closes, RabbitMQ connects again
+// with a growing delay, declares the queues again and resumes the consumers.
+// Publishing fails with ErrNotConnected in the meantime.
+//
+// Messages are published as mandatory in confirm mode, one at a time: Publish
+// returns once the server has taken responsibility for the message.
+type RabbitMQ struct {
+	cfg       Config
+	consumers atomic.Int64
+	// publishMu serializes the publishes, each waits for its confirmation.
+	publishMu sync.Mutex
+
+	mu             sync.Mutex
+	conn           *amqp.Connection
+	publisher      *publisher
+	consumeChannel *amqp.Channel
+	// ready is closed while connected, and replaced when the connection is lost.
+	ready chan struct{}
+	// lastErr is the reason the connection was lost, nil while connected.
+	lastErr error
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRabbitMQ connects to the server of cfg and declares its queues.
+// Only the first connection has to succeed, the next ones are retried.
+func NewRabbitMQ(cfg Config) (*RabbitMQ, error) {
+	r := &RabbitMQ{
+		cfg:    cfg,
+		ready:  make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	if r.cfg.ConfirmTimeout <= 0 {
+		r.cfg.ConfirmTimeout = defaultConfirmTimeout
+	}
+
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	go r.watch()
+
+	return r, nil
+}
+
+// connect opens the connection and its channels and declares the queues.
+func (r *RabbitMQ) connect() error {
+	conn, err := amqp.Dial(r.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	// Separate channel for publishing
+	publishChannel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open publish channel: %w", err)
+	}
+
+	// Separate channel for consuming
+	consumeChannel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open consume channel: %w", err)
+	}
+
+	for _, queue := range r.cfg.Queues {
+		var args amqp.Table
+		if queue.MaxPriority > 0 {
+			args = amqp.Table{"x-max-priority": int32(queue.MaxPriority)}
+		}
+		_, err = publishChannel.QueueDeclare(
+			queue.Name, // queue name
+			true,       // durable
+			false,      // delete when unused
+			false,      // exclusive
+			false,      // no-wait
+			args,       // arguments
+		)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to declare queue %s: %w", queue.Name, err)
+		}
+		logger.Log.Infof("Queue '%s' declared successfully", queue.Name)
+
+		// The messages left behind are moved again on the next connection.
+		if queue.Previous != "" {
+			if err := r.moveMessages(conn, queue.Previous, queue.Name); err != nil {
+				logger.Log.Errorf("Failed to move the messages of %s to %s: %v", queue.Previous, queue.Name, err)
+			}
+		}
+	}
+
+	if err := publishChannel.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	p := &publisher{
+		channel:  publishChannel,
+		confirms: publishChannel.NotifyPublish(make(chan amqp.Confirmation, confirmBuffer)),
+		returns:  publishChannel.NotifyReturn(make(chan amqp.Return, confirmBuffer)),
+	}
+
+	r.mu.Lock()
+	r.conn = conn
+	r.publisher = p
+	r.consumeChannel = consumeChannel
+	r.lastErr = nil
+	close(r.ready)
+	r.mu.Unlock()
+
+	logger.Log.Info("Connected to RabbitMQ")
+	return nil
+}
+
+// moveMessages moves the messages of the queue from, if it exists, to the queue to,
+// then deletes from. Each message is acknowledged once to has confirmed its copy, a
+// failure leaves the remaining ones in from. The queue from is kept while consumers
+// or publishers of a previous version still use it.
+func (r *RabbitMQ) moveMessages(conn *amqp.Connection, from, to string) error {
+	// A missing queue closes the channel, it isn't shared.
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	if _, err := channel.QueueDeclarePassive(from, true, false, false, false, nil); err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+			return nil
+		}
+		return err
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		return err
+	}
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+	moved := 0
+	for {
+		msg, ok, err := channel.Get(from, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		err = channel.Publish("", to, false, false, amqp.Publishing{
+			Headers:      msg.Headers,
+			ContentType:  msg.ContentType,
+			DeliveryMode: msg.DeliveryMode,
+			Priority:     msg.Priority,
+			MessageId:    msg.MessageId,
+			Body:         msg.Body,
+		})
+		if err != nil {
+			return err
+		}
+
+		select {
+		case confirm, ok := <-confirms:
+			if !ok || !confirm.Ack {
+				return fmt.Errorf("%w: moved message not confirmed", ErrNotAccepted)
+			}
+		case <-time.After(r.cfg.ConfirmTimeout):
+			return fmt.Errorf("%w: no confirmation within %s", ErrNotAccepted, r.cfg.ConfirmTimeout)
+		}
+
+		if err := msg.Ack(false); err != nil {
+			return err
+		}
+		moved++
+	}
+	if moved > 0 {
+		logger.Log.Infof("Moved %d messages from %s to %s", moved, from, to)
+	}
+
+	if _, err := channel.QueueDelete(from, true, true, false); err != nil {
+		return fmt.Errorf("%s is still in use: %w", from, err)
+	}
+	logger.Log.Infof("Queue '%s' deleted", from)
+	return nil
+}
+
+// watch reconnects whenever the connection or one of its channels closes,
+// until the broker is closed.
+func (r *RabbitMQ) watch() {
+	for {
+		r.mu.Lock()
+		conn, publishChannel, consumeChannel := r.conn, r.publisher.channel, r.consumeChannel
+		r.mu.Unlock()
+
+		// The notification channels must be buffered, the library blocks on them.
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		publishClosed := publishChannel.NotifyClose(make(chan *amqp.Error, 1))
+		consumeClosed := consumeChannel.NotifyClose(make(chan *amqp.Error, 1))
+
+		var amqpErr *amqp.Error
+		select {
+		case <-r.closed:
+			return
+		case amqpErr = <-connClosed:
+		case amqpErr = <-publishClosed:
+		case amqpErr = <-consumeClosed:
+		}
+
+		var lost error = ErrNotConnected
+		if amqpErr != nil {
+			lost = fmt.Errorf("%w: %v", ErrNotConnected, amqpErr)
+		}
+		logger.Log.Errorf("RabbitMQ connection lost: %v", lost)
+
+		r.mu.Lock()
+		r.ready = make(chan struct{})
+		r.lastErr = lost
+		r.mu.Unlock()
+		// A channel may have closed alone, the whole connection is started over.
+		conn.Close()
+
+		if !r.reconnect() {
+			return
+		}
+	}
+}
+
+// reconnect connects again with a growing delay. It reports false if the broker
+// was closed first.
+func (r *RabbitMQ) reconnect() bool {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-r.closed:
+			return false
+		case <-time.After(delay):
+		}
+
+		err := r.connect()
+		if err == nil {
+			return true
+		}
+
+		r.mu.Lock()
+		r.lastErr = fmt.Errorf("%w: %v", ErrNotConnected, err)
+		r.mu.Unlock()
+
+		delay = min(delay*2, maxReconnectDelay)
+		logger.Log.Errorf("Reconnecting to RabbitMQ failed, retrying in %s: %v", delay, err)
+	}
+}
+
+// Health returns nil while connected, otherwise why the connection was lost.
+func (r *RabbitMQ) Health() error {
+	select {
+	case <-r.closed:
+		return ErrClosed
+	default:
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastErr
+}
+
+// Publish sends msg to queue through the default exchange and waits for the
+// server to confirm it. It fails with ErrNotAccepted if the message is
+// rejected or can't be routed to queue, and with ErrUnconfirmed if the wait
+// for the confirmation ends first, after ConfirmTimeout, a lost connection or
+// once ctx is done.
+func (r *RabbitMQ) Publish(ctx context.Context, queue string, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := r.Health(); err != nil {
+		return err
+	}
+
+	r.publishMu.Lock()
+	defer r.publishMu.Unlock()
+
+	r.mu.Lock()
+	p := r.publisher
+	r.mu.Unlock()
+
+	// Leftovers of messages that weren't confirmed in time.
+	p.drain()
+
+	p.seq++
+	messageID := strconv.FormatUint(p.seq, 10)
+	err := p.channel.Publish(
+		"",    // exchange
+		queue, // routing key (queue name)
+		true,  // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType: msg.ContentType,
+			Body:        msg.Body,
+			Priority:    msg.Priority,
+			MessageId:   messageID,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(r.cfg.ConfirmTimeout)
+	defer timer.Stop()
+
+	// An unroutable message is returned before it is confirmed.
+	var returned *amqp.Return
+	for {
+		select {
+		case ret, ok := <-p.returns:
+			if !ok {
+				return fmt.Errorf("%w: %w before the message was confirmed", ErrUnconfirmed, ErrNotConnected)
+			}
+			if ret.MessageId == messageID {
+				returned = &ret
+			}
+		case confirm, ok := <-p.confirms:
+			if !ok {
+				return fmt.Errorf("%w: %w before the message was confirmed", ErrUnconfirmed, ErrNotConnected)
+			}
+			if confirm.DeliveryTag < p.seq {
+				continue
+			}
+			if !confirm.Ack {
+				return fmt.Errorf("%w: rejected by the server", ErrNotAccepted)
+			}
+			if returned == nil {
+				returned = p.returned(messageID)
+			}
+			if returned != nil {
+				return fmt.Errorf("%w: returned with %d %s", ErrNotAccepted, returned.ReplyCode, returned.ReplyText)
+			}
+			return nil
+		case <-timer.C:
+			return fmt.Errorf("%w: no confirmation within %s", ErrUnconfirmed, r.cfg.ConfirmTimeout)
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrUnconfirmed, ctx.Err())
+		}
+	}
+}
+
+// drain drops the pending confirmations and returns.
+func (p *publisher) drain() {
+	for {
+		select {
+		case _, ok := <-p.confirms:
+			if !ok {
+				return
+			}
+		case _, ok := <-p.returns:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// returned picks the return of messageID among the pending ones, if any.
+func (p *publisher) returned(messageID string) *amqp.Return {
+	for {
+		select {
+		case ret, ok := <-p.returns:
+			if !ok {
+				return nil
+			}
+			if ret.MessageId == messageID {
+				return &ret
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// Consume registers a consumer of queue, cancelled once ctx is done. The consumer
+// is registered again after a reconnection, deliveries that weren't acknowledged
+// on the lost connection are delivered again by the server.
+//
+// Priorities only order the messages waiting in the queue, so the server must not
+// push them all to the consumer: it holds prefetch unacknowledged messages at most.
+func (r *RabbitMQ) Consume(ctx context.Context, queue string, prefetch int) (<-chan Delivery, error) {
+	if err := r.Health(); errors.Is(err, ErrClosed) {
+		return nil, err
+	}
+
+	deliveries := make(chan Delivery)
+	go func() {
+		defer close(deliveries)
+		for {
+			consumeChannel, ok := r.waitConnected(ctx)
+			if !ok {
+				return
+			}
+
+			if err := r.forward(ctx, consumeChannel, queue, max(prefetch, 1), deliveries); err != nil {
+				logger.Log.Errorf("Consumer of %s stopped, resuming once reconnected: %v", queue, err)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Waits for the watcher to notice the lost connection before resuming.
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.closed:
+				return
+			case <-time.After(minReconnectDelay):
+			}
+		}
+	}()
+
+	return deliveries, nil
+}
+
+// waitConnected returns the consume channel once connected. It reports false
+// if ctx is done or the broker closed first.
+func (r *RabbitMQ) waitConnected(ctx context.Context) (*amqp.Channel, bool) {
+	r.mu.Lock()
+	ready := r.ready
+	r.mu.Unlock()
+
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return nil, false
+	case <-r.closed:
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.consumeChannel, true
+}
+
+// forward registers a consumer of queue on consumeChannel and hands its messages
+// to deliveries until ctx is done or the channel closes.
+func (r *RabbitMQ) forward(ctx context.Context, consumeChannel *amqp.Channel, queue string, prefetch int, deliveries chan<- Delivery) error {
+	if err := consumeChannel.Qos(prefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set the prefetch count: %w", err)
+	}
+
+	tag := fmt.Sprintf("%s-%d-%d", queue, os.Getpid(), r.consumers.Add(1))
+	msgs, err := consumeChannel.Consume(
+		queue, // queue name
+		tag,   // consumer tag
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %w", err)
+	}
+	logger.Log.Infof("Consuming %s", queue)
+
+	for {
+		select {
+		case <-ctx.Done():
+			consumeChannel.Cancel(tag, false)
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return ErrNotConnected
+			}
+			delivery := Delivery{
+				Message: Message{ContentType: msg.ContentType, Body: msg.Body, Priority: msg.Priority},
+				ack:     func() error { return msg.Ack(false) },
+				nack:    func(requeue bool) error { return msg.Nack(false, requeue) },
+			}
+			select {
+			case deliveries <- delivery:
+			case <-ctx.Done():
+				msg.Nack(false, true)
+				consumeChannel.Cancel(tag, false)
+				return nil
+			}
+		}
+	}
+}
+
+// Close stops reconnecting and closes the channels and the connection.
+func (r *RabbitMQ) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// The connection may be lost already.
+	if err := r.conn.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+		return err
+	}
+	return nil
+}
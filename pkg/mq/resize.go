@@ -1,6 +1,7 @@
 package mq
 
 import (
+	"context"
 	"fmt"
 
 	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
@@ -10,77 +11,94 @@ import (
 	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
 
 	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
-	"github.com/streadway/amqp"
 )
 
+// ResizeQueue is the queue of the resize jobs. It has priorities, which RabbitMQ
+// can't add to an existing queue, so it replaces legacyResizeQueue.
+const ResizeQueue = "image_resize_priority"
+
+// legacyResizeQueue is the queue of the resize jobs before priorities.
+const legacyResizeQueue = "image_resize"
+
+// PublishResizeJob queues a job. It returns once the broker has accepted it.
+// An error means the job won't be processed, except ErrUnconfirmed after which
+// it may still be.
 func PublishResizeJob(resizeJob model.ResizeJob) error {
 	logger.Log.Info("PublishResizeJob")
 
-	ch := GetPublishChannel()
-	if ch == nil {
-		logger.Log.Fatalf("RabbitMQ channel is not available")
-		return fmt.Errorf("rabbitmq channel not available")
+	b := GetBroker()
+	if b == nil {
+		logger.Log.Error("Message broker is not available")
+		return fmt.Errorf("message broker not available")
 	}
 
 	body, err := json.Marshal(resizeJob)
 	if err != nil {
-		logger.Log.Fatalf("Failed to marshal resizeJob: %v", err)
+		logger.Log.Errorf("Failed to marshal resizeJob: %v", err)
 		return err
 	}
 
-	err = ch.Publish(
-		"",             // exchange
-		"image_resize", // routing key (queue name)
-		false,          // mandatory
-		false,          // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	err = b.Publish(context.Background(), ResizeQueue, Message{
+		ContentType: "application/json",
+		Body:        body,
+		Priority:    resizeJob.Priority,
+	})
 	if err != nil {
-		logger.Log.Fatalf("Failed to publish message: %v", err)
+		logger.Log.Errorf("Failed to publish message: %v", err)
+		return err
 	}
 
-	logger.Log.Infof("Job published to rabbitmq: %s", resizeJob.JobID)
-	return err
+	logger.Log.Infof("Job published: %s", resizeJob.JobID)
+	return nil
+}
+
+// ResizeJobDelivery is a job taken from the queue. It must be acknowledged once
+// processed, or nacked to give it back to the queue.
+type ResizeJobDelivery struct {
+	Delivery
+	Job model.ResizeJob
 }
 
-func ConsumeResizeJobs(jobs chan<- model.ResizeJob) {
+// ConsumeResizeJobs sends the queued jobs to the worker pool through jobs
+// until ctx is done or the broker is closed. Up to prefetch jobs are taken from
+// the queue before being acknowledged, it should match the number of workers.
+func ConsumeResizeJobs(ctx context.Context, jobs chan<- ResizeJobDelivery, prefetch int) error {
 	logger.Log.Info("ConsumeResizeJobs")
 
-	ch := GetConsumeChannel()
-	if ch == nil {
-		logger.Log.Fatalf("RabbitMQ channel is not available")
-		return
+	b := GetBroker()
+	if b == nil {
+		return fmt.Errorf("message broker not available")
 	}
 
-	msgs, err := ch.Consume(
-		"image_resize", // queue name
-		"",             // consumer tag
-		true,           // auto-ack
-		false,          // exclusive
-		false,          // no-local
-		false,          // no-wait
-		nil,            // arguments
-	)
+	deliveries, err := b.Consume(ctx, ResizeQueue, prefetch)
 	if err != nil {
-		logger.Log.Fatalf("Failed to register a consumer: %v", err)
+		return err
 	}
 
-	// Continuously listens to the message channel (msgs) provided by the RabbitMQ library.
 	// When a new message is received, it is decoded into a model.ResizeJob struct.
-	// The job is then sent to the worker pool via the jobs channel.
-	// The for msg := range msgs loop will block and wait if the channel is empty.
-	for msg := range msgs {
+	// The job is then sent to the worker pool via the jobs channel, along with the
+	// delivery the worker acknowledges once the job is processed.
+	// The loop will block and wait if the channel is empty.
+	for delivery := range deliveries {
 		var job model.ResizeJob
-		if err := json.Unmarshal(msg.Body, &job); err != nil {
+		if err := json.Unmarshal(delivery.Body, &job); err != nil {
 			logger.Log.Warnf("Failed to decode message: %v", err)
+			// A message that can't be decoded never will, it is dropped.
+			delivery.Nack(false)
 			continue
 		}
-		logger.Log.Infof("Consuming job from rabbitmq: %s", job.JobID)
+		logger.Log.Infof("Consuming job: %s", job.JobID)
 
-		jobs <- job
-		logger.Log.Infof("Job sent to worker: %s", job.JobID)
+		select {
+		case jobs <- ResizeJobDelivery{Delivery: delivery, Job: job}:
+			logger.Log.Infof("Job sent to worker: %s", job.JobID)
+		case <-ctx.Done():
+			// Shutting down, the job is left to another worker.
+			if err := delivery.Nack(true); err != nil {
+				logger.Log.Warnf("Failed to requeue job %s: %v", job.JobID, err)
+			}
+		}
 	}
+
+	return nil
 }
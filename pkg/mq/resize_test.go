@@ -0,0 +1,99 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+func receiveJob(t *testing.T, jobs <-chan ResizeJobDelivery) ResizeJobDelivery {
+	t.Helper()
+	select {
+	case d := <-jobs:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no job")
+	}
+	return ResizeJobDelivery{}
+}
+
+func TestConsumeResizeJobs(t *testing.T) {
+	b := NewMemory()
+	defer b.Close()
+	SetBroker(b)
+	defer SetBroker(nil)
+
+	for _, job := range []model.ResizeJob{
+		{JobID: "low", Priority: 0},
+		{JobID: "high", Priority: 9},
+		{JobID: "normal", Priority: 5},
+	} {
+		if err := PublishResizeJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Malformed messages are dropped instead of reaching the workers.
+	if err := b.Publish(context.Background(), ResizeQueue, Message{Body: []byte("{"), Priority: MaxPriority}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan ResizeJobDelivery)
+	done := make(chan error)
+	go func() { done <- ConsumeResizeJobs(ctx, jobs, 1) }()
+
+	first := receiveJob(t, jobs)
+	if first.Job.JobID != "high" {
+		t.Fatalf("got job %s, want high", first.Job.JobID)
+	}
+	// A single job is taken until the worker acknowledges it.
+	select {
+	case d := <-jobs:
+		t.Fatalf("got job %s before the first one was acknowledged", d.Job.JobID)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := first.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := receiveJob(t, jobs)
+	if second.Job.JobID != "normal" {
+		t.Fatalf("got job %s, want normal", second.Job.JobID)
+	}
+	// A job given back is delivered again.
+	if err := second.Nack(true); err != nil {
+		t.Fatal(err)
+	}
+	if d := receiveJob(t, jobs); d.Job.JobID != "normal" {
+		t.Fatalf("got job %s, want normal again", d.Job.JobID)
+	} else if err := d.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stopping requeues the job waiting for a worker.
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ConsumeResizeJobs returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ConsumeResizeJobs did not return")
+	}
+
+	deliveries, err := b.Consume(context.Background(), ResizeQueue, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job model.ResizeJob
+	if err := json.Unmarshal(receive(t, deliveries).Body, &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.JobID != "low" {
+		t.Fatalf("got job %s, want low", job.JobID)
+	}
+}
@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"time"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+
+	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+	"github.com/IlfGauhnith/GophicProcessor/pkg/mq"
+)
+
+const (
+	defaultInterval = 15 * time.Second
+	// batchSize is the number of due jobs claimed at once.
+	batchSize = 50
+	// lease keeps a claimed job from being claimed again while it is published.
+	lease = time.Minute
+)
+
+// Interval is how often the scheduler looks for due jobs,
+// from SCHEDULER_INTERVAL as a Go duration.
+func Interval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("SCHEDULER_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return defaultInterval
+	}
+	return interval
+}
+
+// Run publishes the scheduled jobs to the queue once they are due, until ctx is done.
+// Jobs are held in Postgres, every API instance can run a scheduler.
+func Run(ctx context.Context) {
+	interval := Interval()
+	logger.Log.Infof("Scheduler started, checking for due jobs every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		releaseDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			logger.Log.Info("Scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseDue publishes every due job, a batch at a time. The jobs are published
+// once their claim is committed, a job failing to publish is put back and the
+// rest wait for the next check.
+func releaseDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		jobs, err := data_handler.ClaimDueScheduledJobs(ctx, batchSize, lease)
+		if err != nil {
+			logger.Log.Errorf("Failed to claim due scheduled jobs: %v", err)
+			return
+		}
+
+		published, failed := publish(context.WithoutCancel(ctx), jobs)
+		if published > 0 {
+			logger.Log.Infof("Scheduler published %d due jobs", published)
+		}
+		if failed || len(jobs) < batchSize {
+			return
+		}
+	}
+}
+
+// publish queues the claimed jobs, stopping at the first one failing to publish.
+// That one and the ones after it are put back.
+func publish(ctx context.Context, jobs []model.ResizeJob) (int, bool) {
+	for i, job := range jobs {
+		if err := mq.PublishResizeJob(job); err != nil {
+			logger.Log.Errorf("Failed to publish scheduled job %s: %v", job.JobID, err)
+			for _, job := range jobs[i:] {
+				// A job not put back is published once its lease runs out.
+				if err := data_handler.RestoreScheduledJob(ctx, job.JobID); err != nil {
+					logger.Log.Errorf("Failed to put back scheduled job %s: %v", job.JobID, err)
+				}
+			}
+			return i, true
+		}
+
+		// A job not removed is published again once its lease runs out.
+		if err := data_handler.RemoveScheduledJob(ctx, job.JobID); err != nil {
+			logger.Log.Errorf("Failed to remove published scheduled job %s: %v", job.JobID, err)
+		}
+	}
+	return len(jobs), false
+}
@@ -88,6 +88,11 @@ func ValidateJWT(tokenString string) (*jwt.Token, error) {
 		return nil, err
 	}
 
+	// Scoped tokens, such as the stream tokens, don't give access to the rest of the API.
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && claims["scope"] != nil {
+		return nil, fmt.Errorf("token is scoped to %v", claims["scope"])
+	}
+
 	return token, nil
 }
 
@@ -163,3 +168,62 @@ func GetUserFromJWT(tokenString string) (*model.User, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// streamScope is the scope of the tokens opening event streams.
+const streamScope = "events"
+
+// StreamTokenTTL is how long a stream token can be used to open a stream.
+// An open stream isn't affected by the expiration, reconnecting takes a new token.
+const StreamTokenTTL = time.Minute
+
+// StreamClaims are what a stream token gives access to: the events of the jobs
+// of UserID, only those of JobID when it isn't empty.
+type StreamClaims struct {
+	UserID int
+	JobID  string
+}
+
+// GenerateStreamToken generates a short-lived token opening the event streams of
+// claims. Unlike the login token it can travel in a URL, as EventSource requires.
+func GenerateStreamToken(claims StreamClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"scope":   streamScope,
+		"user_id": claims.UserID,
+		"job_id":  claims.JobID,
+		"exp":     time.Now().Add(StreamTokenTTL).Unix(),
+		"iat":     time.Now().Unix(),
+	})
+
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		logger.Log.Errorf("Error signing stream token: %v", err)
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// ValidateStreamToken verifies a stream token and returns its claims.
+// Any other token is rejected.
+func ValidateStreamToken(tokenString string) (*StreamClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtSecret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["scope"] != streamScope {
+		return nil, errors.New("not a stream token")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("user_id not found in token")
+	}
+	jobID, _ := claims["job_id"].(string)
+
+	return &StreamClaims{UserID: int(userID), JobID: jobID}, nil
+}
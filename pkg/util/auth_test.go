@@ -0,0 +1,52 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+func TestStreamToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims StreamClaims
+	}{
+		{"job stream", StreamClaims{UserID: 7, JobID: "2b0c6a5e-job"}},
+		{"user stream", StreamClaims{UserID: 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := GenerateStreamToken(tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ValidateStreamToken(token)
+			if err != nil {
+				t.Fatalf("ValidateStreamToken failed: %v", err)
+			}
+			if *got != tt.claims {
+				t.Fatalf("got claims %+v, want %+v", *got, tt.claims)
+			}
+
+			// A stream token doesn't give access to the rest of the API.
+			if _, err := ValidateJWT(token); err == nil {
+				t.Fatal("ValidateJWT accepted a stream token")
+			}
+		})
+	}
+}
+
+func TestValidateStreamTokenRejectsLoginToken(t *testing.T) {
+	login, err := GenerateJWT(model.User{ID: 7, Email: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{login, "", "not.a.token"} {
+		if _, err := ValidateStreamToken(token); err == nil {
+			t.Fatalf("ValidateStreamToken accepted %q", token)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -14,7 +15,9 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-func UploadToR2(imageData []byte, fileName string) (string, error) {
+// UploadToR2 uploads an image and returns its presigned URL.
+// The upload is aborted when ctx is done.
+func UploadToR2(ctx context.Context, imageData []byte, fileName string) (string, error) {
 	bucket := os.Getenv("R2_BUCKET_NAME")
 	accountID := os.Getenv("R2_ACCOUNT_ID")
 	accessKey := os.Getenv("R2_ACCESS_KEY_ID")
@@ -45,7 +48,7 @@ func UploadToR2(imageData []byte, fileName string) (string, error) {
 		ACL:    aws.String("public-read"),
 	}
 
-	_, err = svc.PutObject(input)
+	_, err = svc.PutObjectWithContext(ctx, input)
 	if err != nil {
 		return "", fmt.Errorf("failed to upload image to R2: %v", err)
 	}
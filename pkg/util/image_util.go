@@ -5,14 +5,29 @@ import (
 	"encoding/base64"
 	"fmt"
 	"image"
+	_ "image/gif"
 	"image/jpeg"
+	_ "image/png"
+
+	preflight "github.com/IlfGauhnith/GophicProcessor/pkg/imageproc/preflight"
 )
 
-func DecodeBase64Image(base64Str string) (image.Image, error) {
+// DecodeBase64Data decodes a base64 string into its raw bytes.
+func DecodeBase64Data(base64Str string) ([]byte, error) {
 	decoded, err := base64.StdEncoding.DecodeString(base64Str)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode base64: %v", err)
 	}
+	return decoded, nil
+}
+
+// DecodeBase64Image decodes a base64 image, or data URI, after checking its format
+// and size against the limits of the preflight package.
+func DecodeBase64Image(base64Str string) (image.Image, error) {
+	decoded, err := preflight.Decode(base64Str, preflight.LimitsFromEnv())
+	if err != nil {
+		return nil, err
+	}
 
 	img, _, err := image.Decode(bytes.NewReader(decoded))
 	if err != nil {
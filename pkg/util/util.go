@@ -32,8 +32,8 @@ func WaitForShutdown() {
 	sig := <-shutdown
 	logger.Log.Infof("Received signal: %s, shutting down...", sig)
 
-	// Perform RabbitMQ cleanup
-	mq.CloseRabbitMQ()
+	// Perform message broker cleanup
+	mq.CloseBroker()
 
 	// Perform DB cleanup
 	db.CloseDB()
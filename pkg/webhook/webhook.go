@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	_ "github.com/IlfGauhnith/GophicProcessor/pkg/config"
+
+	data_handler "github.com/IlfGauhnith/GophicProcessor/pkg/db/data_handler"
+	logger "github.com/IlfGauhnith/GophicProcessor/pkg/logger"
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+// Statuses of a delivery.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// EventJobFinished is sent once a job is completed, failed or cancelled.
+const EventJobFinished = "job.finished"
+
+// Headers of a delivery. The signature is the hex HMAC-SHA256, keyed with the
+// webhook secret of the owner of the job, of the timestamp header, a dot and the
+// body, see Sign.
+const (
+	SignatureHeader = "X-Gophic-Signature"
+	TimestampHeader = "X-Gophic-Timestamp"
+	EventHeader     = "X-Gophic-Event"
+	DeliveryHeader  = "X-Gophic-Delivery"
+)
+
+const (
+	defaultMaxAttempts = 8
+	// The first retry waits baseBackoff, each next one twice as long up to maxBackoff.
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+
+	requestTimeout = 10 * time.Second
+	// lease keeps a claimed delivery from being claimed again while it is sent.
+	lease        = time.Minute
+	batchSize    = 20
+	pollInterval = 5 * time.Second
+)
+
+// secretPrefix starts the webhook secrets, which makes them easy to recognize.
+const secretPrefix = "whsec_"
+
+var (
+	errPrivateAddress = errors.New("callback resolves to a private address")
+	errNoSecret       = errors.New("the owner of the job has no webhook secret")
+)
+
+// Event is the body of a delivery.
+type Event struct {
+	Event string          `json:"event"`
+	Job   model.ResizeJob `json:"job"`
+}
+
+// ValidateURL checks a callback URL given with a job.
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid callback URL: %v", err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("callback URL must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// NewSecret generates a webhook secret. Each user signs its webhooks with its own,
+// so that receivers verify them without being able to forge the webhooks of others.
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := cryptorand.Read(key); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(key), nil
+}
+
+// Sign returns the signature of a delivery body sent at timestamp.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Enqueue records the delivery of the final state of a job to its callback URL,
+// if it has one. Run sends it.
+func Enqueue(ctx context.Context, job model.ResizeJob) error {
+	if job.CallbackURL == "" {
+		return nil
+	}
+
+	// Only the outcome is sent, not the options of the job.
+	payload, err := json.Marshal(Event{
+		Event: EventJobFinished,
+		Job: model.ResizeJob{
+			JobID:     job.JobID,
+			Status:    job.Status,
+			Images:    job.Images,
+			Algorithm: job.Algorithm,
+			Mode:      job.Mode,
+			OwnerID:   job.OwnerID,
+			Results:   job.Results,
+			Progress:  job.Progress,
+			ErrorCode: job.ErrorCode,
+			Error:     job.Error,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return data_handler.SaveWebhookDelivery(ctx, job.JobID, job.OwnerID, job.CallbackURL, payload)
+}
+
+// Run sends the pending deliveries once they are due until ctx is done, retrying
+// failed ones with exponential backoff up to WEBHOOK_MAX_ATTEMPTS attempts.
+// Deliveries are claimed in Postgres, several instances can run side by side.
+func Run(ctx context.Context) {
+	maxAttempts := defaultMaxAttempts
+	if value, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && value > 0 {
+		maxAttempts = value
+	}
+
+	client := newClient(os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true")
+	logger.Log.Info("Webhook delivery started")
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			deliveries, err := data_handler.ClaimDueWebhookDeliveries(ctx, batchSize, lease)
+			if err != nil {
+				logger.Log.Errorf("Failed to claim webhook deliveries: %v", err)
+				break
+			}
+			for _, delivery := range deliveries {
+				deliver(ctx, client, maxAttempts, delivery)
+			}
+			if len(deliveries) < batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver makes one attempt of a delivery and records its outcome. The retries
+// of a redelivered delivery count from its redelivery.
+func deliver(ctx context.Context, client *http.Client, maxAttempts int, delivery model.WebhookDelivery) {
+	attempt := model.WebhookAttempt{Attempt: delivery.Attempts + 1}
+	retry := attempt.Attempt - delivery.AttemptsBase
+
+	start := time.Now()
+	statusCode, err := send(ctx, client, delivery)
+	attempt.DurationMs = int(time.Since(start).Milliseconds())
+	attempt.StatusCode = statusCode
+
+	status := StatusDelivered
+	nextAttemptAt := time.Now()
+	if err == nil && (statusCode < 200 || statusCode > 299) {
+		err = fmt.Errorf("unexpected response status %d", statusCode)
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+		if retry >= maxAttempts {
+			status = StatusFailed
+		} else {
+			status = StatusPending
+			nextAttemptAt = nextAttemptAt.Add(backoff(retry))
+		}
+		logger.Log.Warnf("Webhook delivery %d of job %s failed (attempt %d): %v", delivery.ID, delivery.JobID, attempt.Attempt, err)
+	} else {
+		logger.Log.Infof("Webhook of job %s delivered to %s", delivery.JobID, delivery.URL)
+	}
+
+	if err := data_handler.RecordWebhookAttempt(context.WithoutCancel(ctx), delivery.ID, attempt, status, nextAttemptAt); err != nil {
+		logger.Log.Errorf("Failed to record webhook attempt of delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// backoff is the delay before the attempt following attempt, with up to 10% of jitter
+// so that the deliveries failing together don't all retry at the same time.
+func backoff(attempt int) time.Duration {
+	delay := maxBackoff
+	if attempt <= 20 {
+		delay = min(baseBackoff<<(attempt-1), maxBackoff)
+	}
+	return delay + time.Duration(rand.Int64N(int64(delay/10)+1))
+}
+
+func send(ctx context.Context, client *http.Client, delivery model.WebhookDelivery) (int, error) {
+	if delivery.Secret == "" {
+		return 0, errNoSecret
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GophicProcessor-Webhook")
+	req.Header.Set(EventHeader, EventJobFinished)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign([]byte(delivery.Secret), timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Draining a bit of the body lets the connection be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return resp.StatusCode, nil
+}
+
+// newClient returns the HTTP client of the deliveries. Unless allowPrivate is set,
+// it refuses to connect to loopback, private and link-local addresses, checked
+// once the name is resolved, so that callbacks can't reach internal services.
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{Transport: transport, Timeout: requestTimeout}
+}
@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	model "github.com/IlfGauhnith/GophicProcessor/pkg/model"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"job.finished"}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		want      string
+	}{
+		{"delivery", "secret", "1700000000", body, "sha256=7e727e7d2b8027b25bb0412971e76f7f2fcb5ededae3cebb9b1595daeb971b35"},
+		{"other timestamp", "secret", "1700000001", body, "sha256=ae510d9d21bdcff6fa51d082e596651addd8c6e1f2a8502d3ca4572ad96e0c19"},
+		{"empty body", "other", "1700000000", nil, "sha256=0eaddda63fe194e9945e7d364f142d9269b757e14bfcfc330d1bb0e85e0e6543"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign([]byte(tt.secret), tt.timestamp, tt.body); got != tt.want {
+				t.Errorf("Sign() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, baseBackoff},
+		{2, 2 * baseBackoff},
+		{5, 16 * baseBackoff},
+		{10, 512 * baseBackoff},
+		{11, maxBackoff},
+		{21, maxBackoff},
+		{1000, maxBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			// The jitter adds up to 10%.
+			for i := 0; i < 20; i++ {
+				got := backoff(tt.attempt)
+				if got < tt.want || got > tt.want+tt.want/10 {
+					t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.want, tt.want+tt.want/10)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://example.com/hooks/jobs", false},
+		{"http://example.com:8080/hook?token=1", false},
+		{"ftp://example.com/hook", true},
+		{"/hooks/jobs", true},
+		{"https://", true},
+		{"://example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if err := ValidateURL(tt.url); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateURL(%q) error = %v, want error %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	secret := "whsec_test"
+	payload := []byte(`{"event":"job.finished","job":{"job_id":"abc"}}`)
+
+	var received *http.Request
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		secret       string
+		allowPrivate bool
+		wantStatus   int
+		wantErr      error
+	}{
+		{"private networks allowed", secret, true, http.StatusAccepted, nil},
+		{"private networks refused", secret, false, 0, errPrivateAddress},
+		{"no secret", "", true, 0, errNoSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			delivery := model.WebhookDelivery{ID: 7, URL: server.URL, Payload: payload, Secret: tt.secret}
+
+			status, err := send(context.Background(), newClient(tt.allowPrivate), delivery)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("send() error = %v, want %v", err, tt.wantErr)
+				}
+				if received != nil {
+					t.Fatal("the request reached the server")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("send() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("send() status = %d, want %d", status, tt.wantStatus)
+			}
+
+			if string(receivedBody) != string(payload) {
+				t.Errorf("body = %s, want %s", receivedBody, payload)
+			}
+			if got := received.Header.Get(DeliveryHeader); got != "7" {
+				t.Errorf("%s = %q, want 7", DeliveryHeader, got)
+			}
+			want := Sign([]byte(secret), received.Header.Get(TimestampHeader), payload)
+			if got := received.Header.Get(SignatureHeader); got != want {
+				t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+			}
+		})
+	}
+}
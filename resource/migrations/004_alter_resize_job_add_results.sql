@@ -0,0 +1,13 @@
+-- Begin the migration transaction
+BEGIN;
+
+-- Job mode ('resize', 'responsive', ...)
+ALTER TABLE tb_resize_job
+ADD COLUMN mode VARCHAR(20) NOT NULL DEFAULT 'resize';
+
+-- Per image results (dimensions, sizes, responsive variants, errors)
+ALTER TABLE tb_resize_job
+ADD COLUMN results JSONB NOT NULL DEFAULT '[]';
+
+-- Commit the transaction
+COMMIT;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS tb_image_hash (
+    image_hash_id SERIAL PRIMARY KEY,
+    owner_id INT NOT NULL REFERENCES tb_user(user_id) ON DELETE CASCADE,
+    resize_job_uuid VARCHAR(50) NOT NULL,
+    image_index INT NOT NULL,
+    image_url TEXT,
+    ahash BIGINT NOT NULL,             -- 64 bit hashes stored as signed integers
+    dhash BIGINT NOT NULL,
+    phash BIGINT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT unique_job_image UNIQUE (resize_job_uuid, image_index)
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_hash_owner ON tb_image_hash (owner_id);
@@ -0,0 +1,13 @@
+-- Begin the migration transaction
+BEGIN;
+
+-- Machine readable reason of a failed job ('internal_error', ...)
+ALTER TABLE tb_resize_job
+ADD COLUMN error_code VARCHAR(40);
+
+-- Human readable description of the failure
+ALTER TABLE tb_resize_job
+ADD COLUMN error_message TEXT;
+
+-- Commit the transaction
+COMMIT;
@@ -0,0 +1,9 @@
+-- Begin the migration transaction
+BEGIN;
+
+-- Subscription tier of the user ('free', 'pro'), raises the priority of its jobs
+ALTER TABLE tb_user
+ADD COLUMN tier VARCHAR(20) NOT NULL DEFAULT 'free';
+
+-- Commit the transaction
+COMMIT;
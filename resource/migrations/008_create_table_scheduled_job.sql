@@ -0,0 +1,11 @@
+-- Jobs held until run_at, payload being the whole queue message, inputs included
+CREATE TABLE IF NOT EXISTS tb_scheduled_job (
+    resize_job_uuid VARCHAR(50) PRIMARY KEY REFERENCES tb_resize_job(resize_job_uuid) ON DELETE CASCADE,
+    owner_id INT NOT NULL REFERENCES tb_user(user_id) ON DELETE CASCADE,
+    run_at TIMESTAMPTZ NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_job_run_at ON tb_scheduled_job (run_at);
+CREATE INDEX IF NOT EXISTS idx_scheduled_job_owner ON tb_scheduled_job (owner_id);
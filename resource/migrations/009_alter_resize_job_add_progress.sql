@@ -0,0 +1,9 @@
+-- Begin the migration transaction
+BEGIN;
+
+-- Latest progress reported by the worker (total, processed, failed, current, ETA)
+ALTER TABLE tb_resize_job
+ADD COLUMN progress JSONB;
+
+-- Commit the transaction
+COMMIT;
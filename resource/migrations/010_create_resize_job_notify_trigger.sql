@@ -0,0 +1,26 @@
+-- Notifies 'resize_job_events' listeners when a job is created or its status or progress changes
+CREATE OR REPLACE FUNCTION fn_notify_resize_job_event() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.status IS NOT DISTINCT FROM OLD.status
+        AND NEW.progress IS NOT DISTINCT FROM OLD.progress THEN
+        RETURN NEW;
+    END IF;
+
+    PERFORM pg_notify('resize_job_events', json_build_object(
+        'job_id', NEW.resize_job_uuid,
+        'owner_id', NEW.owner_id,
+        'status', NEW.status,
+        'progress', NEW.progress,
+        'errorCode', NEW.error_code
+    )::text);
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_resize_job_event ON tb_resize_job;
+
+CREATE TRIGGER trg_resize_job_event
+AFTER INSERT OR UPDATE ON tb_resize_job
+FOR EACH ROW EXECUTE FUNCTION fn_notify_resize_job_event();
@@ -0,0 +1,39 @@
+-- Begin the migration transaction
+BEGIN;
+
+-- URL notified once the job is finished
+ALTER TABLE tb_resize_job
+ADD COLUMN callback_url TEXT;
+
+-- Notification of a finished job, retried until delivered or out of attempts
+CREATE TABLE IF NOT EXISTS tb_webhook_delivery (
+    webhook_delivery_id SERIAL PRIMARY KEY,
+    resize_job_uuid VARCHAR(50) NOT NULL REFERENCES tb_resize_job(resize_job_uuid) ON DELETE CASCADE,
+    owner_id INT NOT NULL REFERENCES tb_user(user_id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- 'pending', 'delivered', 'failed'
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_due ON tb_webhook_delivery (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_job ON tb_webhook_delivery (resize_job_uuid);
+
+-- Every attempt of a delivery, status_code being NULL when no response was received
+CREATE TABLE IF NOT EXISTS tb_webhook_attempt (
+    webhook_attempt_id SERIAL PRIMARY KEY,
+    webhook_delivery_id INT NOT NULL REFERENCES tb_webhook_delivery(webhook_delivery_id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    status_code INT,
+    error TEXT,
+    duration_ms INT NOT NULL,
+    attempted_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_attempt_delivery ON tb_webhook_attempt (webhook_delivery_id);
+
+-- Commit the transaction
+COMMIT;
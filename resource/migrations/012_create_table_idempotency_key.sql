@@ -0,0 +1,12 @@
+-- Idempotency-Key of a job submission, fingerprint being the SHA-256 of the request
+CREATE TABLE IF NOT EXISTS tb_idempotency_key (
+    owner_id INT NOT NULL REFERENCES tb_user(user_id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    resize_job_uuid VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (owner_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_key_expires_at ON tb_idempotency_key (expires_at);
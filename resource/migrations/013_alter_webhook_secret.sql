@@ -0,0 +1,13 @@
+-- Begin the migration transaction
+BEGIN;
+
+-- Key of the signatures of the webhooks of the user, shown once when it is generated
+ALTER TABLE tb_user
+ADD COLUMN webhook_secret TEXT;
+
+-- Attempts made before the latest redelivery, the retries of a delivery count from there
+ALTER TABLE tb_webhook_delivery
+ADD COLUMN attempts_base INT NOT NULL DEFAULT 0;
+
+-- Commit the transaction
+COMMIT;
@@ -0,0 +1,10 @@
+-- Begin the migration transaction
+BEGIN;
+
+-- When the scheduler claimed the job to publish it, NULL while it waits for run_at.
+-- A claimed job can't be rescheduled anymore, and the worker notifies its cancellation.
+ALTER TABLE tb_scheduled_job
+ADD COLUMN claimed_at TIMESTAMPTZ;
+
+-- Commit the transaction
+COMMIT;
@@ -0,0 +1,10 @@
+-- Begin the migration transaction
+BEGIN;
+
+-- Whether the submission holding the key is still creating its job, the retries are
+-- refused meanwhile instead of being handed a job that may never exist
+ALTER TABLE tb_idempotency_key
+ADD COLUMN pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Commit the transaction
+COMMIT;